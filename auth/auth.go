@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strconv"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -22,11 +23,7 @@ const (
 // timestamp is used to verify every message
 // signed via ECDSA algo by metamask.
 func OnboardingSiganture(privateKey *ecdsa.PrivateKey, timestamp int64) (string, error) {
-	metamaskMessage := fmt.Sprintf("%s\n%d", ONBOARDING_MESSAGE, timestamp)
-	eip191Message := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(metamaskMessage), metamaskMessage)
-
-	message := crypto.Keccak256Hash([]byte(eip191Message)).Bytes()
-	signature, err := crypto.Sign(message, privateKey)
+	signature, err := crypto.Sign(onboardingHash(timestamp), privateKey)
 	if err != nil {
 		return "", err
 	}
@@ -34,17 +31,87 @@ func OnboardingSiganture(privateKey *ecdsa.PrivateKey, timestamp int64) (string,
 	return hexutil.Encode(signature), nil
 }
 
+// RecoverOnboardingSigner returns the address of the key which produced
+// onboarding signature for the given timestamp. Both raw (V is 0 or 1)
+// and metamask (V is 27 or 28) signatures are accepted.
+func RecoverOnboardingSigner(signature string, timestamp int64) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid signature length %d", len(sig))
+	}
+
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pubKey, err := crypto.SigToPub(onboardingHash(timestamp), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
+
+// VerifyOnboardingSignature checks that onboarding signature for the given
+// timestamp was produced by the wallet owner.
+func VerifyOnboardingSignature(wallet string, signature string, timestamp int64) (bool, error) {
+	if !common.IsHexAddress(wallet) {
+		return false, fmt.Errorf("invalid wallet address %s", wallet)
+	}
+
+	signer, err := RecoverOnboardingSigner(signature, timestamp)
+	if err != nil {
+		return false, err
+	}
+
+	return signer == common.HexToAddress(wallet), nil
+}
+
+// onboardingHash returns keccak256 hash of EIP-191 onboarding message.
+func onboardingHash(timestamp int64) []byte {
+	metamaskMessage := fmt.Sprintf("%s\n%d", ONBOARDING_MESSAGE, timestamp)
+	eip191Message := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(metamaskMessage), metamaskMessage)
+
+	return crypto.Keccak256Hash([]byte(eip191Message)).Bytes()
+}
+
 // PayloadSignature returns HMAC-SHA256 signature after signing payload hash with
 // provided by user secret. Later this signature is used to ensure
 // signer of payload was valid. From high level overview payload
 // can be signed by frontend user by rotating random secret or by
 // market maker with constant api key secret.
 func PayloadSignature(payload map[string]string, secret string, timestamp int64) (string, error) {
-	secretBytes, err := hexutil.Decode(secret)
+	signature, err := payloadMac(payload, secret, timestamp)
 	if err != nil {
 		return "", err
 	}
 
+	return hexutil.Encode(signature), nil
+}
+
+// VerifyPayloadSignature checks that signature was produced by PayloadSignature
+// for the same payload, secret and timestamp.
+func VerifyPayloadSignature(payload map[string]string, secret string, timestamp int64, signature string) (bool, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return false, err
+	}
+
+	expected, err := payloadMac(payload, secret, timestamp)
+	if err != nil {
+		return false, err
+	}
+
+	return hmac.Equal(sig, expected), nil
+}
+
+// PayloadMessage returns the string which is hashed and signed by PayloadSignature:
+// alphabetically ordered key=value pairs followed by the timestamp.
+func PayloadMessage(payload map[string]string, timestamp int64) string {
 	// Sort payload keys and prepare an alphabetically ordered string.
 	var message string
 	sortedKeys := make([]string, 0, len(payload))
@@ -57,17 +124,21 @@ func PayloadSignature(payload map[string]string, secret string, timestamp int64)
 		message += fmt.Sprintf("%s=%s", k, payload[k])
 	}
 
-	timestampStr := strconv.FormatInt(timestamp, 10)
+	return message + strconv.FormatInt(timestamp, 10)
+}
+
+// payloadMac calculates raw HMAC-SHA256 of the payload message hash.
+func payloadMac(payload map[string]string, secret string, timestamp int64) ([]byte, error) {
+	secretBytes, err := hexutil.Decode(secret)
+	if err != nil {
+		return nil, err
+	}
 
 	// Calculate hash itself with given input.
-	input := make([]byte, 0, len(message)+len(timestampStr))
-	input = append(input, []byte(message)...)
-	input = append(input, []byte(timestampStr)...)
-	hash := sha256.Sum256(input)
+	hash := sha256.Sum256([]byte(PayloadMessage(payload, timestamp)))
 
 	mac := hmac.New(sha256.New, secretBytes)
 	mac.Write(hash[:])
-	signature := mac.Sum(nil)
 
-	return hexutil.Encode(signature), nil
+	return mac.Sum(nil), nil
 }
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Golden vectors. The payload MACs were cross-checked with Python's hmac and hashlib.
+const (
+	testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	testWallet     = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+	testSecret     = "0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testTimestamp  = int64(1700000000)
+
+	testOnboardingTimestamp = int64(1700000000000)
+	testOnboardingSignature = "0x001048e71dee8986b7ffb225218e7e1a84bb797aadb340b29c30f504129c8482" +
+		"0243965bdae587c07f7119315e1663a8bd1c2bd50b03031579f7afa2796c7bc600"
+
+	testOrderMessage   = "market_id=BTC-USDmethod=POSTpath=/ordersprice=27000.5side=longsize=0.0011700000000"
+	testOrderSignature = "0x2d475cfa71206c27b44e43ea7a809dd13dae57c674422d7b1616ae30bd8de464"
+	testEmptySignature = "0x83e3c34ed5eb9f94c7f7764fa61416a8b45d5a812f93076f7c385e58f1eea476"
+)
+
+// testOrderPayload returns the payload of the order golden vector.
+func testOrderPayload() map[string]string {
+	return map[string]string{
+		"side":      "long",
+		"size":      "0.001",
+		"price":     "27000.5",
+		"path":      "/orders",
+		"method":    "POST",
+		"market_id": "BTC-USD",
+	}
+}
+
+func TestPayloadMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   map[string]string
+		timestamp int64
+		want      string
+	}{
+		{"order", testOrderPayload(), testTimestamp, testOrderMessage},
+		{"empty", map[string]string{}, testTimestamp, "1700000000"},
+		{"nil", nil, 0, "0"},
+		{"negative timestamp", map[string]string{"a": "1"}, -5, "a=1-5"},
+		{"byte order", map[string]string{"b": "2", "B": "3", "a": "1", "_": "4"}, 1, "B=3_=4a=1b=21"},
+		{"prefix keys", map[string]string{"ab": "2", "a": "1", "a_b": "3"}, 1, "a=1a_b=3ab=21"},
+		{"empty value", map[string]string{"price": "", "size": "null"}, 1, "price=size=null1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PayloadMessage(tt.payload, tt.timestamp); got != tt.want {
+				t.Errorf("PayloadMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayloadSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload map[string]string
+		want    string
+	}{
+		{"order", testOrderPayload(), testOrderSignature},
+		{"empty", map[string]string{}, testEmptySignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PayloadSignature(tt.payload, testSecret, testTimestamp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("PayloadSignature() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayloadSignatureKeyOrder(t *testing.T) {
+	// Maps built in a different insertion order sign the same message.
+	reordered := map[string]string{}
+	keys := []string{"market_id", "method", "path", "price", "side", "size"}
+	for i := len(keys) - 1; i >= 0; i-- {
+		reordered[keys[i]] = testOrderPayload()[keys[i]]
+	}
+
+	got, err := PayloadSignature(reordered, testSecret, testTimestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != testOrderSignature {
+		t.Errorf("PayloadSignature() = %s, want %s", got, testOrderSignature)
+	}
+}
+
+func TestPayloadSignatureBadSecret(t *testing.T) {
+	for _, secret := range []string{"", "000102", "0x0g", "0x123"} {
+		if _, err := PayloadSignature(testOrderPayload(), secret, testTimestamp); err == nil {
+			t.Errorf("PayloadSignature() with secret %q: expected error", secret)
+		}
+	}
+}
+
+func TestVerifyPayloadSignature(t *testing.T) {
+	changed := testOrderPayload()
+	changed["size"] = "0.002"
+
+	tests := []struct {
+		name      string
+		payload   map[string]string
+		timestamp int64
+		signature string
+		want      bool
+		wantErr   bool
+	}{
+		{"valid", testOrderPayload(), testTimestamp, testOrderSignature, true, false},
+		{"upper case hex", testOrderPayload(), testTimestamp, "0x" + strings.ToUpper(testOrderSignature[2:]), true, false},
+		{"changed value", changed, testTimestamp, testOrderSignature, false, false},
+		{"changed timestamp", testOrderPayload(), testTimestamp + 1, testOrderSignature, false, false},
+		{"truncated", testOrderPayload(), testTimestamp, testOrderSignature[:len(testOrderSignature)-2], false, false},
+		{"missing prefix", testOrderPayload(), testTimestamp, testOrderSignature[2:], false, true},
+		{"odd length", testOrderPayload(), testTimestamp, testOrderSignature[:len(testOrderSignature)-1], false, true},
+		{"not hex", testOrderPayload(), testTimestamp, "0xzz", false, true},
+		{"empty", testOrderPayload(), testTimestamp, "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyPayloadSignature(tt.payload, testSecret, tt.timestamp, tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyPayloadSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyPayloadSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnboardingSignature(t *testing.T) {
+	key, err := crypto.HexToECDSA(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signatures are deterministic (RFC 6979), so the golden value is stable.
+	got, err := OnboardingSiganture(key, testOnboardingTimestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != testOnboardingSignature {
+		t.Errorf("OnboardingSiganture() = %s, want %s", got, testOnboardingSignature)
+	}
+}
+
+// withV returns the onboarding golden signature with the recovery byte replaced.
+func withV(v string) string {
+	return testOnboardingSignature[:len(testOnboardingSignature)-2] + v
+}
+
+func TestRecoverOnboardingSigner(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature string
+		timestamp int64
+		wantErr   bool
+		wantMatch bool
+	}{
+		{"raw v", testOnboardingSignature, testOnboardingTimestamp, false, true},
+		{"metamask v", withV("1b"), testOnboardingTimestamp, false, true},
+		{"upper case hex", "0x" + strings.ToUpper(testOnboardingSignature[2:]), testOnboardingTimestamp, false, true},
+		{"other timestamp", testOnboardingSignature, testOnboardingTimestamp + 1, false, false},
+		{"flipped v", withV("01"), testOnboardingTimestamp, false, false},
+		{"flipped metamask v", withV("1c"), testOnboardingTimestamp, false, false},
+		{"invalid v", withV("05"), testOnboardingTimestamp, true, false},
+		{"invalid metamask v", withV("1d"), testOnboardingTimestamp, true, false},
+		{"short", testOnboardingSignature[:len(testOnboardingSignature)-2], testOnboardingTimestamp, true, false},
+		{"long", testOnboardingSignature + "00", testOnboardingTimestamp, true, false},
+		{"missing prefix", testOnboardingSignature[2:], testOnboardingTimestamp, true, false},
+		{"odd length", testOnboardingSignature[:len(testOnboardingSignature)-1], testOnboardingTimestamp, true, false},
+		{"not hex", "0x" + strings.Repeat("zz", 65), testOnboardingTimestamp, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := RecoverOnboardingSigner(tt.signature, tt.timestamp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RecoverOnboardingSigner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if match := signer.Hex() == testWallet; match != tt.wantMatch {
+				t.Errorf("RecoverOnboardingSigner() = %s, match %v, want match %v", signer.Hex(), match, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestVerifyOnboardingSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		wallet    string
+		signature string
+		timestamp int64
+		want      bool
+		wantErr   bool
+	}{
+		{"checksum wallet", testWallet, testOnboardingSignature, testOnboardingTimestamp, true, false},
+		{"lower case wallet", strings.ToLower(testWallet), testOnboardingSignature, testOnboardingTimestamp, true, false},
+		{"metamask v", testWallet, withV("1b"), testOnboardingTimestamp, true, false},
+		{"other wallet", "0x0000000000000000000000000000000000000001", testOnboardingSignature, testOnboardingTimestamp, false, false},
+		{"other timestamp", testWallet, testOnboardingSignature, testOnboardingTimestamp - 1, false, false},
+		{"flipped v", testWallet, withV("01"), testOnboardingTimestamp, false, false},
+		{"invalid wallet", "0x1234", testOnboardingSignature, testOnboardingTimestamp, false, true},
+		{"malformed signature", testWallet, "0x1234", testOnboardingTimestamp, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyOnboardingSignature(tt.wallet, tt.signature, tt.timestamp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyOnboardingSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyOnboardingSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// CanonicalPayload converts a JSON object request body into the flat
+// payload map signed by PayloadSignature. Every top level field becomes
+// one entry, its value is encoded by the following rules:
+//
+//   - string is used as is, without quotes and JSON escaping;
+//   - number is written in plain decimal notation without exponent
+//     and trailing zeros, so 1e-3, 0.0010 and 0.001 all become "0.001";
+//   - bool is "true" or "false";
+//   - null fields carry no value and are left out of the payload;
+//   - arrays and objects are written as compact JSON with object keys
+//     sorted, nested numbers and nulls kept by the same rules, strings
+//     quoted without HTML escaping.
+//
+// Empty body or JSON null produce an empty payload.
+func CanonicalPayload(body []byte) (map[string]string, error) {
+	payload := map[string]string{}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return payload, nil
+	}
+
+	value, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return payload, nil
+	}
+
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("payload must be a JSON object")
+	}
+
+	for k, v := range fields {
+		if v == nil {
+			continue
+		}
+
+		if s, ok := v.(string); ok {
+			payload[k] = s
+			continue
+		}
+
+		var sb strings.Builder
+		if err := writeCanonical(&sb, v); err != nil {
+			return nil, err
+		}
+		payload[k] = sb.String()
+	}
+
+	return payload, nil
+}
+
+// decodeJSON decodes JSON keeping numbers as json.Number.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+
+	return value, nil
+}
+
+// writeCanonical writes canonical form of a decoded JSON value.
+func writeCanonical(sb *strings.Builder, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		sb.WriteString("null")
+	case bool:
+		if v {
+			sb.WriteString("true")
+		} else {
+			sb.WriteString("false")
+		}
+	case json.Number:
+		d, err := decimal.NewFromString(v.String())
+		if err != nil {
+			return err
+		}
+		sb.WriteString(d.String())
+	case string:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		sb.Write(bytes.TrimRight(buf.Bytes(), "\n"))
+	case []interface{}:
+		sb.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			if err := writeCanonical(sb, item); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		sb.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			if err := writeCanonical(sb, k); err != nil {
+				return err
+			}
+			sb.WriteByte(':')
+			if err := writeCanonical(sb, v[k]); err != nil {
+				return err
+			}
+		}
+		sb.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported JSON value %T", value)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"blank", " \n", map[string]string{}, false},
+		{"null body", "null", map[string]string{}, false},
+		{"empty object", "{}", map[string]string{}, false},
+		{"string", `{"market_id":"BTC-USD"}`, map[string]string{"market_id": "BTC-USD"}, false},
+		{"escaped string", `{"id":"a&b"}`, map[string]string{"id": "a&b"}, false},
+		{"escaped quotes", `{"q":"\"quoted\""}`, map[string]string{"q": `"quoted"`}, false},
+		{"null field", `{"price":null,"size":1}`, map[string]string{"size": "1"}, false},
+		{"exponent", `{"size":1e-3}`, map[string]string{"size": "0.001"}, false},
+		{"trailing zeros", `{"size":0.0010}`, map[string]string{"size": "0.001"}, false},
+		{"large exponent", `{"size":1.5E+3}`, map[string]string{"size": "1500"}, false},
+		{"negative", `{"size":-0.50}`, map[string]string{"size": "-0.5"}, false},
+		{"integer", `{"start_time":0}`, map[string]string{"start_time": "0"}, false},
+		{"bool", `{"is_client":true}`, map[string]string{"is_client": "true"}, false},
+		{"array", `{"status":["open","closed"]}`, map[string]string{"status": `["open","closed"]`}, false},
+		{"nested", `{"o":{"b":[1.50,null],"a":"x<y"}}`, map[string]string{"o": `{"a":"x<y","b":[1.5,null]}`}, false},
+		{"whitespace", `{ "o" : { "a" : [ 1 , "x" ] } }`, map[string]string{"o": `{"a":[1,"x"]}`}, false},
+		{"array body", `[1]`, nil, true},
+		{"string body", `"x"`, nil, true},
+		{"invalid", `{"a":}`, nil, true},
+		{"trailing data", `{"a":1}{}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalPayload([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CanonicalPayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CanonicalPayload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The messages and signatures were computed independently with Python's hmac and hashlib.
+func TestCanonicalPayloadGolden(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		message   string
+		signature string
+	}{
+		{
+			"order",
+			`{"market_id":"BTC-USD","type":"limit","side":"long","price":27000.50,"size":1e-3,"client_order_id":null,"time_in_force":"post_only"}`,
+			"market_id=BTC-USDprice=27000.5side=longsize=0.001time_in_force=post_onlytype=limit1700000000",
+			"0x59ef9145cae59736acaf1f722d0589447d578fdfdaf6318f12a5dbeb51772a32",
+		},
+		{
+			"order list",
+			`{"market_id":"BTC-USD","status":["open","closed"],"order_type":null,"start_time":0}`,
+			`market_id=BTC-USDstart_time=0status=["open","closed"]1700000000`,
+			"0xa6beb502ef4f8f82df70ae8b3524e5f934223de03f96a8c48fa04853cc94e1ac",
+		},
+		{
+			"nested and escaped",
+			`{"id":"\"quoted\"","o":{"b":[1.50,null],"a":"x<y"}}`,
+			`id="quoted"o={"a":"x<y","b":[1.5,null]}1700000000`,
+			"0x5c73763f8b82a1d2b12adb5b1f3e7598b5777a856fbdc9ced0e6634c85c54d6e",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := CanonicalPayload([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := PayloadMessage(payload, testTimestamp); got != tt.message {
+				t.Errorf("PayloadMessage() = %q, want %q", got, tt.message)
+			}
+
+			got, err := PayloadSignature(payload, testSecret, testTimestamp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.signature {
+				t.Errorf("PayloadSignature() = %s, want %s", got, tt.signature)
+			}
+		})
+	}
+}
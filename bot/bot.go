@@ -2,130 +2,420 @@
 package bot
 
 import (
+	"errors"
+	"fmt"
 	"rabbitx-client/client"
-	"strconv"
+	"rabbitx-client/model"
+	"rabbitx-client/orderbook"
+	"rabbitx-client/stream"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/centrifugal/centrifuge-go"
 	"github.com/sirupsen/logrus"
 )
 
-var channelPrefix = []string{"market:", "orderbook:", "trade:", "account@"}
+// METRICS_INTERVAL is the time between two logs of channel metrics.
+const METRICS_INTERVAL = time.Minute
+
+// marketChannelPrefix lists the channels subscribed for every market, the account channel is shared.
+var marketChannelPrefix = []string{stream.MARKET_PREFIX, stream.ORDERBOOK_PREFIX, stream.TRADE_PREFIX}
+
+// QueueConfig configures the delivery queue of a channel.
+type QueueConfig struct {
+	Size   int                   // The capacity of the queue, stream.DEFAULT_BUFFER_SIZE if zero.
+	Policy stream.OverflowPolicy // The policy applied when the queue is full.
+}
+
+// ACCOUNT_QUEUE_SIZE is the capacity of the account channel queue. Account updates
+// dropped beyond it are recovered by reconciling the account over REST.
+const ACCOUNT_QUEUE_SIZE = 8 * stream.DEFAULT_BUFFER_SIZE
+
+// defaultQueueConfig returns the queue configuration of each channel prefix.
+// Only the latest market data matters. Account updates get a larger queue, and
+// when updates are dropped anyway the account is reconciled before delivery resumes.
+func defaultQueueConfig() map[string]QueueConfig {
+	return map[string]QueueConfig{
+		stream.MARKET_PREFIX:    {Policy: stream.OVERFLOW_COALESCE_LATEST},
+		stream.ORDERBOOK_PREFIX: {Policy: stream.OVERFLOW_COALESCE_LATEST},
+		stream.TRADE_PREFIX:     {Policy: stream.OVERFLOW_DROP_OLDEST},
+		stream.ACCOUNT_PREFIX:   {Size: ACCOUNT_QUEUE_SIZE, Policy: stream.OVERFLOW_DROP_OLDEST},
+	}
+}
 
 // DummyBot is a struct that represents a dummy bot for executing trades on RabbitX.
-// It contains the marketId, client, wsUrl, jwtPrivate, profileID, wsClient and done.
+// It contains the marketIds, client, wsUrl, jwtPrivate, profileID, ws stream, deadMan, account mirror,
+// recorder, channel health monitor, done, the watchdog of each market, the delivery queues of subscribed channels,
+// the factory of market strategies and their risk limits.
 type DummyBot struct {
-	marketId   string
-	client     *client.RbClient
-	wsUrl      string
-	jwtPrivate string
-	profileID  uint
-	wsClient   *centrifuge.Client
-	done       chan struct{}
+	marketIds    []string
+	watchdogs    map[string]*WatchDog
+	client       *client.RbClient
+	wsUrl        string
+	jwtPrivate   string
+	profileID    uint
+	ws           *stream.Stream
+	deadMan      *client.DeadManSwitch
+	account      *client.AccountMirror
+	recorder     *stream.Recorder
+	health       *stream.HealthMonitor
+	healthConfig stream.HealthConfig
+	done         chan struct{}
+	muQueue      sync.Mutex
+	queueConfig  map[string]QueueConfig
+	queues       map[string]*stream.Queue
+	newStrategy  StrategyFactory
+	limits       RiskLimits
+	stopOnce     sync.Once
 }
 
 // NewBot is a function that creates a new DummyBot.
 // It takes a client, wsUrl and jwtPrivate as parameters and returns a pointer to a DummyBot.
 func NewBot(client *client.RbClient, wsUrl, jwtPrivate string) *DummyBot {
 	return &DummyBot{
-		client:     client,
-		wsUrl:      wsUrl,
-		jwtPrivate: jwtPrivate,
-		done:       make(chan struct{}),
+		client:       client,
+		wsUrl:        wsUrl,
+		jwtPrivate:   jwtPrivate,
+		done:         make(chan struct{}),
+		queueConfig:  defaultQueueConfig(),
+		healthConfig: stream.DefaultHealthConfig(),
+		queues:       make(map[string]*stream.Queue),
+		newStrategy:  NewDummyStrategy,
+	}
+}
+
+// SetStrategy sets the factory creating the strategy of each market run next, DummyStrategy by default.
+func (b *DummyBot) SetStrategy(factory StrategyFactory) {
+	b.newStrategy = factory
+}
+
+// SetRiskLimits sets the limits checked before strategies of the next run send orders.
+func (b *DummyBot) SetRiskLimits(limits RiskLimits) {
+	b.limits = limits
+}
+
+// Stop stops the watchdogs and waits until their strategies are stopped.
+// Strategies may still cancel their orders in OnStop.
+func (b *DummyBot) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.done)
+	})
+
+	for _, wd := range b.allWatchdogs() {
+		wd.Wait()
 	}
 }
 
-// Run is a method of DummyBot that runs the bot for a specific marketID.
-// It sets the profile ID, connects the client to the websocket, subscribes to open channels and runs the watchdog.
+// SetQueueConfig sets the delivery queue of channels with the prefix, e.g. stream.MARKET_PREFIX.
+// It applies to subscriptions made by the next Run.
+func (b *DummyBot) SetQueueConfig(prefix string, config QueueConfig) {
+	b.muQueue.Lock()
+	defer b.muQueue.Unlock()
+
+	b.queueConfig[prefix] = config
+}
+
+// Dropped returns the number of publications dropped by the overflow policy of each channel.
+func (b *DummyBot) Dropped() map[string]uint64 {
+	b.muQueue.Lock()
+	defer b.muQueue.Unlock()
+
+	res := make(map[string]uint64, len(b.queues))
+	for channel, q := range b.queues {
+		res[channel] = q.Dropped()
+	}
+
+	return res
+}
+
+// Run is a method of DummyBot that runs the bot for the given markets on one websocket connection.
+// It sets the profile ID, connects the stream to the websocket, subscribes to open channels
+// and runs a watchdog with its own state and strategy for each market.
 // It returns an error if any.
-func (b *DummyBot) Run(marketID string) error {
-	// Set profile Id
-	profileData, err := b.client.GetProfile()
-	if err != nil {
+func (b *DummyBot) Run(marketIds ...string) error {
+	if len(marketIds) == 0 {
+		return errors.New("at least one market is required")
+	}
+
+	// Mirror the account, it loads the profile and sets profile Id
+	b.account = client.NewAccountMirror(b.client, client.DEFAULT_RECONCILE_INTERVAL)
+	if err := b.account.Start(); err != nil {
 		return err
 	}
 
-	b.marketId = marketID
-	b.profileID = profileData.ProfileID
+	b.profileID = b.account.Snapshot().ProfileID
 	logrus.Infof("ProfileId = %d detected", b.profileID)
 
-	// Connect client to websocket
-	b.wsClient = centrifuge.NewJsonClient(
-		b.wsUrl,
-		centrifuge.Config{
-			Token:            b.jwtPrivate,
-			ReadTimeout:      10 * time.Second,
-			WriteTimeout:     10 * time.Second,
-			HandshakeTimeout: 10 * time.Second,
-		},
-	)
-
-	b.wsClient.OnConnecting(func(e centrifuge.ConnectingEvent) {
-		logrus.Infof("Connecting - %d (%s) url: %s", e.Code, e.Reason, b.wsUrl)
-	})
+	// Create a watchdog for each market
+	b.createWatchdogs(marketIds)
 
-	b.wsClient.OnConnected(func(e centrifuge.ConnectedEvent) {
-		logrus.Infof("Connected with ID %s", e.ClientID)
+	// Cancel resting orders if the bot stalls or stays disconnected
+	b.deadMan = client.NewDeadManSwitch(b.client, client.DeadManConfig{
+		Markets: b.marketIds,
 	})
 
-	b.wsClient.OnDisconnected(func(e centrifuge.DisconnectedEvent) {
-		logrus.Infof("Disconnected: %d (%s)", e.Code, e.Reason)
-	})
+	// Connect client to websocket and subscribe to market channels
+	if err := b.connect(b.jwtPrivate); err != nil {
+		return err
+	}
+
+	// The account channel is shared, every watchdog picks the orders of its market
+	if err := b.subscribe(stream.ACCOUNT_PREFIX, stream.AccountChannel(b.profileID), b.allWatchdogs()...); err != nil {
+		return err
+	}
+
+	b.deadMan.Start()
+	b.health.Start()
+	go b.logMetrics()
+
+	for _, wd := range b.allWatchdogs() {
+		wd.deadMan = b.deadMan
+		if err := wd.Run(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunPublic is a method of DummyBot that follows public market, orderbook and trade channels
+// of the given markets without credentials. Nothing is traded and no private endpoint is called,
+// so it suits machines which must never hold keys. The websocket token may be empty.
+// It returns an error if any.
+func (b *DummyBot) RunPublic(marketIds ...string) error {
+	if len(marketIds) == 0 {
+		return errors.New("at least one market is required")
+	}
+
+	// Markets are public, load them so market updates can be merged
+	if err := b.client.Markets().Refresh(); err != nil {
+		return err
+	}
+
+	b.createWatchdogs(marketIds)
+
+	if err := b.connect(b.jwtPrivate); err != nil {
+		return err
+	}
+
+	b.health.Start()
+	go b.logMetrics()
+
+	for _, wd := range b.allWatchdogs() {
+		wd.readOnly = true
+		if err := wd.Run(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// connect is a method of DummyBot that connects the stream to the websocket with the token
+// and subscribes each watchdog to the channels of its market.
+func (b *DummyBot) connect(token string) error {
+	b.ws = stream.New(b.wsUrl, token)
+	if b.recorder != nil {
+		b.ws.Tap(b.recorder.Record)
+	}
 
-	b.wsClient.OnError(func(e centrifuge.ErrorEvent) {
-		logrus.Errorf("Websocket server connection Error: %s", e.Error.Error())
+	// Track liveness of all channels, stale market data pauses quoting in its market
+	b.health = stream.NewHealthMonitor(b.healthConfig)
+	b.health.OnStale(func(health stream.ChannelHealth) {
+		b.notify(StreamEvent{Type: STREAM_STALE, Channel: health.Channel})
+	})
+	b.health.OnFresh(func(health stream.ChannelHealth) {
+		b.notify(StreamEvent{Type: STREAM_FRESH, Channel: health.Channel})
+	})
+	b.ws.Tap(b.health.Observe)
+	b.ws.OnConnected(func() {
+		if b.deadMan != nil {
+			b.deadMan.Connected()
+		}
+		b.notify(StreamEvent{Type: STREAM_CONNECTED})
+	})
+	b.ws.OnDisconnected(func(code uint32, reason string) {
+		if b.deadMan != nil {
+			b.deadMan.Disconnected()
+		}
+		b.notify(StreamEvent{Type: STREAM_DISCONNECTED})
+	})
+	b.ws.OnRecovery(func(channel string, recovered bool) {
+		if !recovered {
+			b.handleGap(channel)
+		}
 	})
 
-	err = b.wsClient.Connect()
-	if err != nil {
+	if err := b.ws.Connect(); err != nil {
 		return err
 	}
 
 	logrus.Info("Subscribing...")
 
-	// Create a channel for event data
-	dataCh := make(chan EventData)
+	// Subscribe to market channels, each delivered to the watchdog of its market
+	for _, marketId := range b.marketIds {
+		for _, prefix := range marketChannelPrefix {
+			if err := b.subscribe(prefix, prefix+marketId, b.watchdogs[marketId]); err != nil {
+				return err
+			}
+			b.health.Watch(prefix + marketId)
+		}
+	}
+
+	return nil
+}
+
+// allWatchdogs returns the watchdogs in market order.
+func (b *DummyBot) allWatchdogs() []*WatchDog {
+	all := make([]*WatchDog, 0, len(b.marketIds))
+	for _, marketId := range b.marketIds {
+		all = append(all, b.watchdogs[marketId])
+	}
+
+	return all
+}
+
+// SetHealthConfig sets the staleness thresholds of channels used by the next Run.
+func (b *DummyBot) SetHealthConfig(config stream.HealthConfig) {
+	b.healthConfig = config
+}
+
+// Health returns liveness metrics of all channels: last message time, rate, latency and staleness.
+func (b *DummyBot) Health() []stream.ChannelHealth {
+	if b.health == nil {
+		return nil
+	}
+
+	return b.health.Stats()
+}
 
-	// Subscribe to open channels
-	for _, prefix := range channelPrefix {
-		var channel string
-		if strings.HasPrefix(prefix, "account@") {
-			channel = prefix + strconv.Itoa(int(b.profileID))
-		} else {
-			channel = prefix + b.marketId
+// logMetrics periodically logs liveness metrics and drop counters of all channels.
+func (b *DummyBot) logMetrics() {
+	ticker := time.NewTicker(METRICS_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dropped := b.Dropped()
+			for _, health := range b.Health() {
+				logrus.WithFields(logrus.Fields{
+					"channel": health.Channel,
+					"last":    health.LastMessage.Format(time.RFC3339),
+					"rate":    fmt.Sprintf("%.2f/s", health.Rate),
+					"latency": health.Latency,
+					"stale":   health.Stale,
+					"dropped": dropped[health.Channel],
+				}).Info("Channel metrics")
+			}
+		case <-b.done:
+			return
 		}
+	}
+}
 
-		logrus.Infof("Subscribing to channel: %s", channel)
-		sub, err := b.wsClient.NewSubscription(channel, centrifuge.SubscriptionConfig{
-			Recoverable: true,
-		})
-		if err != nil {
-			return err
+// SetRecorder records all publications received by the next Run,
+// and the orderbook snapshots loaded over REST, so a replay syncs the books.
+func (b *DummyBot) SetRecorder(recorder *stream.Recorder) {
+	b.recorder = recorder
+}
+
+// createWatchdogs creates a watchdog for each distinct market.
+func (b *DummyBot) createWatchdogs(marketIds []string) {
+	b.marketIds = nil
+	b.watchdogs = make(map[string]*WatchDog)
+	for _, marketId := range marketIds {
+		if _, ok := b.watchdogs[marketId]; ok {
+			continue
 		}
 
-		sub.OnSubscribed(func(e centrifuge.SubscribedEvent) {
-			logrus.Info("Subscribed successfully to channel: ", channel)
-		})
+		b.marketIds = append(b.marketIds, marketId)
+		wd := NewWatchDog(b.client, b.account, marketId, b.newStrategy(marketId), b.limits, make(chan EventData), b.done)
+		if b.recorder != nil {
+			wd.book = orderbook.New(marketId, b.recordedSnapshot)
+		}
+		b.watchdogs[marketId] = wd
+	}
+}
 
-		sub.OnPublication(func(e centrifuge.PublicationEvent) {
-			//Potential block here -that's why we need goroutine
-			//OnPublication handler can't be block, or it will block the whole event loop
-			go func() {
-				dataCh <- EventData{
-					WsChannel: channel,
-					Data:      e.Data,
-				}
-			}()
-		})
+// recordedSnapshot loads an orderbook snapshot over REST and records it.
+func (b *DummyBot) recordedSnapshot(marketId string) (*model.OrderbookData, error) {
+	snapshot, err := b.client.GetOrderbook(marketId)
+	if err != nil {
+		return nil, err
+	}
 
-		err = sub.Subscribe()
-		if err != nil {
-			return err
+	b.recorder.RecordSnapshot(stream.ORDERBOOK_PREFIX+marketId, snapshot)
+
+	return snapshot, nil
+}
+
+// handleGap reconciles the state built from a channel which missed publications,
+// the account mirror here and the rest by the watchdogs.
+func (b *DummyBot) handleGap(channel string) {
+	if strings.HasPrefix(channel, stream.ACCOUNT_PREFIX) && b.account != nil {
+		go func() {
+			if err := b.account.Reconcile(); err != nil {
+				logrus.Errorf("Failed to reconcile account: %s", err)
+			}
+		}()
+	}
+
+	b.notify(StreamEvent{Type: STREAM_GAP, Channel: channel})
+}
+
+// notify delivers a stream event to the watchdogs concerned by the channel, all of them
+// for connection events and the account channel.
+func (b *DummyBot) notify(event StreamEvent) {
+	for marketId, wd := range b.watchdogs {
+		if event.Channel != "" && !strings.HasPrefix(event.Channel, stream.ACCOUNT_PREFIX) &&
+			!strings.HasSuffix(event.Channel, ":"+marketId) {
+			continue
 		}
+
+		wd.Notify(event)
+	}
+}
+
+// subscribe delivers publications of the channel to the watchdogs.
+// Each channel is delivered in order by its own bounded queue configured for the prefix,
+// so with the default policies the websocket event loop is never blocked by a slow consumer.
+func (b *DummyBot) subscribe(prefix, channel string, watchdogs ...*WatchDog) error {
+	b.muQueue.Lock()
+	config := b.queueConfig[prefix]
+	b.muQueue.Unlock()
+
+	q, err := b.ws.SubscribeQueued(channel, config.Size, config.Policy, func(p stream.Publication) {
+		// Account updates are merged into the shared mirror before the watchdogs see them.
+		if prefix == stream.ACCOUNT_PREFIX {
+			if err := b.account.ApplyJSON(p.Data); err != nil {
+				logrus.Errorf("Failed to apply account update: %s", err)
+			}
+		}
+
+		data := EventData{WsChannel: p.Channel, Data: p.Data}
+		for _, wd := range watchdogs {
+			select {
+			case wd.dataCh <- data:
+			case <-b.done:
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Dropped account updates are recovered over REST, market data recovers by itself.
+	if prefix == stream.ACCOUNT_PREFIX {
+		q.OnGap(func() {
+			b.handleGap(channel)
+		})
 	}
 
-	wd := NewWatchDog(b.client, b.marketId, dataCh, b.done)
+	b.muQueue.Lock()
+	b.queues[channel] = q
+	b.muQueue.Unlock()
 
-	return wd.Run()
+	return nil
 }
@@ -0,0 +1,284 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"rabbitx-client/client"
+	"rabbitx-client/model"
+	"rabbitx-client/orderbook"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Errors returned by Context order methods.
+var (
+	// ErrPaused is returned when order placement is paused, e.g. while disconnected or on stale data.
+	ErrPaused = errors.New("order placement is paused")
+
+	// ErrReadOnly is returned when the WatchDog does not trade, e.g. in public mode or replay.
+	ErrReadOnly = errors.New("watchdog is read-only")
+
+	// ErrRiskLimit is returned when an order would exceed a risk limit.
+	ErrRiskLimit = errors.New("risk limit exceeded")
+)
+
+// RiskLimits restricts the orders a strategy may send. Zero values mean no limit.
+type RiskLimits struct {
+	MaxOrderSize  decimal.Decimal // The maximum size of one order.
+	MaxOpenOrders int             // The maximum number of open orders in the market.
+	MaxPosition   decimal.Decimal // The maximum absolute position if the order and all open orders on its side fill.
+}
+
+// Context is the execution context of a strategy. It gives access to the market
+// state of the WatchDog and sends orders after risk checks, tracking them in the WatchDog.
+type Context struct {
+	wd     *WatchDog
+	limits RiskLimits
+}
+
+// MarketId returns the market ID of the strategy.
+func (ctx *Context) MarketId() string {
+	return ctx.wd.marketId
+}
+
+// Client returns the client, e.g. for requests not covered by the context.
+func (ctx *Context) Client() *client.RbClient {
+	return ctx.wd.client
+}
+
+// Market returns the cached market data with ticks and minimum order.
+func (ctx *Context) Market() (model.MarketData, error) {
+	return ctx.wd.client.Markets().Market(ctx.wd.marketId)
+}
+
+// BestBid returns the last best bid received on the market channel.
+func (ctx *Context) BestBid() decimal.Decimal {
+	ctx.wd.muMarket.RLock()
+	defer ctx.wd.muMarket.RUnlock()
+
+	return ctx.wd.bestBid
+}
+
+// BestAsk returns the last best ask received on the market channel.
+func (ctx *Context) BestAsk() decimal.Decimal {
+	ctx.wd.muMarket.RLock()
+	defer ctx.wd.muMarket.RUnlock()
+
+	return ctx.wd.bestAsk
+}
+
+// Book returns the local orderbook of the market.
+func (ctx *Context) Book() *orderbook.Book {
+	return ctx.wd.book
+}
+
+// Account returns the account mirror, nil without credentials.
+func (ctx *Context) Account() *client.AccountMirror {
+	return ctx.wd.account
+}
+
+// Position returns the position of the market.
+func (ctx *Context) Position() (model.PositionData, bool) {
+	return ctx.wd.Position()
+}
+
+// Orders returns a copy of the tracked order statuses by order ID.
+func (ctx *Context) Orders() map[string]string {
+	ctx.wd.muOrder.RLock()
+	defer ctx.wd.muOrder.RUnlock()
+
+	res := make(map[string]string, len(ctx.wd.orders))
+	for id, status := range ctx.wd.orders {
+		res[id] = status
+	}
+
+	return res
+}
+
+// OpenOrders returns the IDs of tracked orders which rest in the book.
+func (ctx *Context) OpenOrders() []string {
+	ctx.wd.muOrder.RLock()
+	defer ctx.wd.muOrder.RUnlock()
+
+	res := make([]string, 0, len(ctx.wd.orders))
+	for id, status := range ctx.wd.orders {
+		if status == model.OPEN || status == model.PLACED {
+			res = append(res, id)
+		}
+	}
+
+	return res
+}
+
+// Paused reports whether order placement is paused.
+func (ctx *Context) Paused() bool {
+	ctx.wd.muMarket.RLock()
+	defer ctx.wd.muMarket.RUnlock()
+
+	return len(ctx.wd.pausedBy) > 0
+}
+
+// ReadOnly reports whether the WatchDog does not trade.
+func (ctx *Context) ReadOnly() bool {
+	return ctx.wd.readOnly
+}
+
+// NextClientOrderId returns a new unique client order ID tagged with the strategy tag.
+func (ctx *Context) NextClientOrderId() string {
+	return ctx.wd.idGen.Next()
+}
+
+// PlaceOrder checks the order against pause state and risk limits and sends it.
+func (ctx *Context) PlaceOrder(req *client.DecimalOrderCreateRequest) (*client.OrderCreateResponse, error) {
+	if err := ctx.canTrade(); err != nil {
+		return nil, err
+	}
+
+	if req.MarketId != ctx.wd.marketId {
+		return nil, fmt.Errorf("order of market %s placed from %s", req.MarketId, ctx.wd.marketId)
+	}
+
+	if err := ctx.checkRisk(req.Side, req.Size, 1, ""); err != nil {
+		return nil, err
+	}
+
+	order, err := ctx.wd.client.CreateOrderDecimal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.wd.setOrderStatus(order.OrderId, order.Status)
+	logrus.Infof("Order created id : %s", order.OrderId)
+
+	return order, nil
+}
+
+// AmendOrder checks the new size against risk limits and amends the order.
+// side is the side of the order, it is needed to check the position limit.
+func (ctx *Context) AmendOrder(side string, req *client.DecimalOrderAmendRequest) (*client.OrderCreateResponse, error) {
+	if err := ctx.canTrade(); err != nil {
+		return nil, err
+	}
+
+	if req.MarketId != ctx.wd.marketId {
+		return nil, fmt.Errorf("order of market %s amended from %s", req.MarketId, ctx.wd.marketId)
+	}
+
+	if err := ctx.checkRisk(side, req.Size, 0, req.OrderId); err != nil {
+		return nil, err
+	}
+
+	order, err := ctx.wd.client.AmendOrderDecimal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.wd.setOrderStatus(order.OrderId, order.Status)
+
+	return order, nil
+}
+
+// CancelOrder cancels the order. Cancels are allowed while paused.
+func (ctx *Context) CancelOrder(orderId string) error {
+	if ctx.wd.readOnly {
+		return ErrReadOnly
+	}
+
+	order, err := ctx.wd.client.CancelOrder(&client.OrderCancelRequest{
+		OrderId:  orderId,
+		MarketId: ctx.wd.marketId,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.wd.setOrderStatus(order.OrderId, order.Status)
+	logrus.Infof("Order canceled id : %s", order.OrderId)
+
+	return nil
+}
+
+// CancelAll cancels all open orders in the market and returns how many were canceled.
+func (ctx *Context) CancelAll() (int, error) {
+	if ctx.wd.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	return ctx.wd.client.CancelMarketOrders(ctx.wd.marketId)
+}
+
+// CancelTagged cancels the open orders in the market placed with the strategy tag, also by
+// earlier runs, and returns how many were canceled. Orders of other strategies are left alone.
+func (ctx *Context) CancelTagged() (int, error) {
+	if ctx.wd.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	return ctx.wd.client.CancelTaggedOrders(ctx.wd.marketId, ctx.wd.idGen.Tag())
+}
+
+// canTrade returns an error if orders must not be sent.
+func (ctx *Context) canTrade() error {
+	if ctx.wd.readOnly {
+		return ErrReadOnly
+	}
+
+	if ctx.Paused() {
+		return ErrPaused
+	}
+
+	return nil
+}
+
+// checkRisk checks an order of the given size on the side, newOrders is the number of orders it adds
+// and orderId the amended order, which is replaced by the new size.
+func (ctx *Context) checkRisk(side string, size *decimal.Decimal, newOrders int, orderId string) error {
+	limits := ctx.limits
+
+	if size != nil && limits.MaxOrderSize.IsPositive() && size.GreaterThan(limits.MaxOrderSize) {
+		return fmt.Errorf("%w: size %s over %s", ErrRiskLimit, size, limits.MaxOrderSize)
+	}
+
+	if limits.MaxOpenOrders > 0 && newOrders > 0 && len(ctx.OpenOrders())+newOrders > limits.MaxOpenOrders {
+		return fmt.Errorf("%w: more than %d open orders", ErrRiskLimit, limits.MaxOpenOrders)
+	}
+
+	if size == nil || !limits.MaxPosition.IsPositive() {
+		return nil
+	}
+
+	// The worst case is every resting order on the side filling together with this one.
+	exposure := *size
+	if account := ctx.wd.account; account != nil {
+		for _, order := range account.Orders(ctx.wd.marketId) {
+			if order.Side == side && order.Size != nil && order.OrderId != orderId {
+				exposure = exposure.Add(*order.Size)
+			}
+		}
+	}
+
+	position := signedPosition(ctx.Position())
+	if side == model.SHORT {
+		exposure = exposure.Neg()
+	}
+
+	if position.Add(exposure).Abs().GreaterThan(limits.MaxPosition) {
+		return fmt.Errorf("%w: position would exceed %s", ErrRiskLimit, limits.MaxPosition)
+	}
+
+	return nil
+}
+
+// signedPosition returns the position size, negative for short positions.
+func signedPosition(position model.PositionData, ok bool) decimal.Decimal {
+	if !ok {
+		return decimal.Zero
+	}
+
+	if position.Side == model.SHORT {
+		return position.Size.Abs().Neg()
+	}
+
+	return position.Size
+}
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"errors"
+	"rabbitx-client/client"
+	"rabbitx-client/model"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Constants for the dummy strategy.
+const (
+	DUMMY_PRICE_FACTOR    = 0.94            // The fraction of the best bid the dummy strategy buys at.
+	DUMMY_ORDER_SIZE      = 0.001           // The size of the dummy strategy orders.
+	DUMMY_TIMER_INTERVAL  = time.Second     // The timer interval, a divisor of the order and cancel intervals.
+	DUMMY_ORDER_INTERVAL  = 3 * time.Second // The time between two orders.
+	DUMMY_CANCEL_INTERVAL = 5 * time.Second // The time between two cancels of open orders.
+)
+
+// DummyStrategy buys DUMMY_ORDER_SIZE far below the best bid every DUMMY_ORDER_INTERVAL
+// and cancels its open orders every DUMMY_CANCEL_INTERVAL.
+type DummyStrategy struct {
+	nextOrder  time.Time
+	nextCancel time.Time
+}
+
+// NewDummyStrategy creates a DummyStrategy, it is a StrategyFactory.
+func NewDummyStrategy(marketId string) Strategy {
+	return &DummyStrategy{}
+}
+
+// OnStart is a method that starts the strategy.
+func (s *DummyStrategy) OnStart(ctx *Context) error {
+	now := time.Now()
+	s.nextOrder = now.Add(DUMMY_ORDER_INTERVAL)
+	s.nextCancel = now.Add(DUMMY_CANCEL_INTERVAL)
+	return nil
+}
+
+// TimerInterval is a method that returns DUMMY_TIMER_INTERVAL, so orders and cancels
+// keep their own cadence.
+func (s *DummyStrategy) TimerInterval() time.Duration {
+	return DUMMY_TIMER_INTERVAL
+}
+
+// OnMarket is a method that is called on market data, prices are read from the context.
+func (s *DummyStrategy) OnMarket(ctx *Context, market *model.MarketData) {}
+
+// OnOrderbook is a method that is called on orderbook updates.
+func (s *DummyStrategy) OnOrderbook(ctx *Context, update *model.OrderbookData) {}
+
+// OnTrade is a method that is called on trades.
+func (s *DummyStrategy) OnTrade(ctx *Context, trade *model.TradeData) {}
+
+// OnAccount is a method that is called on account updates.
+func (s *DummyStrategy) OnAccount(ctx *Context, profile *model.ProfileData) {}
+
+// OnOrderUpdate is a method that is called on order updates, statuses are tracked by the context.
+func (s *DummyStrategy) OnOrderUpdate(ctx *Context, order *model.OrderData) {}
+
+// OnTimer is a method that places an order and periodically cancels open orders.
+func (s *DummyStrategy) OnTimer(ctx *Context) {
+	if ctx.ReadOnly() {
+		return
+	}
+
+	now := time.Now()
+	if !now.Before(s.nextOrder) {
+		s.nextOrder = nextDeadline(s.nextOrder, DUMMY_ORDER_INTERVAL, now)
+		s.placeOrder(ctx)
+	}
+
+	if !now.Before(s.nextCancel) {
+		s.nextCancel = nextDeadline(s.nextCancel, DUMMY_CANCEL_INTERVAL, now)
+		s.cancelOrders(ctx)
+	}
+}
+
+// OnStop is a method that stops the strategy, orders are left to the dead man's switch.
+func (s *DummyStrategy) OnStop(ctx *Context) {}
+
+// placeOrder function places an order.
+func (s *DummyStrategy) placeOrder(ctx *Context) {
+	// Never quote off a dead connection or a stale price.
+	if ctx.Paused() {
+		return
+	}
+
+	price := ctx.BestBid().Mul(decimal.NewFromFloat(DUMMY_PRICE_FACTOR))
+	if price.LessThanOrEqual(decimal.Zero) {
+		return
+	}
+
+	// The price is snapped to the market tick by the client.
+	req, err := client.Limit(ctx.MarketId(), model.LONG, price, decimal.NewFromFloat(DUMMY_ORDER_SIZE)).
+		ClientID(ctx.NextClientOrderId()).
+		Build()
+	if err != nil {
+		logrus.Error("Invalid order: ", err)
+		return
+	}
+
+	if _, err := ctx.PlaceOrder(req); err != nil && !errors.Is(err, ErrPaused) {
+		logrus.Error("Failed to create order: ", err)
+	}
+}
+
+// cancelOrders function cancels the open orders.
+func (s *DummyStrategy) cancelOrders(ctx *Context) {
+	for id, status := range ctx.Orders() {
+		if status != model.OPEN && status != model.CANCELING {
+			continue
+		}
+
+		if err := ctx.CancelOrder(id); err != nil {
+			logrus.Error("Failed to cancel order: ", err)
+		}
+	}
+}
+
+// nextDeadline function returns the first deadline after now, deadlines are interval apart
+// from the previous one so the cadence does not drift with the timer.
+func nextDeadline(previous time.Time, interval time.Duration, now time.Time) time.Time {
+	next := previous.Add(interval)
+	if !next.After(now) {
+		next = now.Add(interval)
+	}
+
+	return next
+}
@@ -4,21 +4,10 @@ package bot
 // Importing necessary libraries.
 import (
 	"encoding/json"
-	"math"
 
 	"github.com/sirupsen/logrus"
 )
 
-// roundToNearestTick rounds the size to the nearest tick.
-func roundToNearestTick(size, tick float64) *float64 {
-	if tick <= 0 {
-		return &size
-	}
-	numTicks := math.Round(size / tick)
-	val := numTicks * tick
-	return &val
-}
-
 // decodeAndPrintData decodes and prints data if show is true.
 func decodeAndPrintData[T any](channel string, data []byte, show bool) *T {
 
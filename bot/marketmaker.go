@@ -0,0 +1,461 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"rabbitx-client/client"
+	"rabbitx-client/model"
+	"rabbitx-client/stream"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// MarketMakerConfig configures a MarketMaker. Spreads, spacing, skew and tolerance
+// are fractions of the fair price, e.g. 0.001 is 10 basis points.
+type MarketMakerConfig struct {
+	Spread        decimal.Decimal // The distance between the best bid and ask quotes.
+	LevelSpacing  decimal.Decimal // The extra distance from the fair price of each further level.
+	Size          decimal.Decimal // The size of each quote, the market minimum order if zero.
+	Levels        int             // The number of quotes on each side, 1 if zero.
+	MaxPosition   decimal.Decimal // The absolute position at which the side adding to it stops quoting, no limit if zero.
+	Skew          decimal.Decimal // The shift of all quotes at MaxPosition, against the position so it is reduced.
+	Tolerance     decimal.Decimal // The price move below which a quote is left in place.
+	TimerInterval time.Duration   // The time between two requotes without market updates, DEFAULT_TIMER_INTERVAL if zero.
+}
+
+// DefaultMarketMakerConfig returns a configuration quoting one minimum size level on each side, 20 bps wide.
+func DefaultMarketMakerConfig() MarketMakerConfig {
+	return MarketMakerConfig{
+		Spread:       decimal.NewFromFloat(0.002),
+		LevelSpacing: decimal.NewFromFloat(0.001),
+		Levels:       1,
+		Skew:         decimal.NewFromFloat(0.001),
+		Tolerance:    decimal.NewFromFloat(0.0002),
+	}
+}
+
+// quote is a resting order of the market maker. size stays the quoted size after partial
+// fills, so requotes compare the wanted size with it and not with the remaining size.
+type quote struct {
+	orderId string
+	price   decimal.Decimal
+	size    decimal.Decimal
+	filled  decimal.Decimal
+}
+
+// MarketMaker quotes both sides around the fair price of the market with post-only limit orders.
+// Quotes are skewed against the current position and the side adding to it stops quoting
+// at MaxPosition. Quotes which moved are amended in place, they are canceled only when
+// a level is no longer wanted or an amend fails.
+type MarketMaker struct {
+	config MarketMakerConfig
+	quotes map[string][]*quote // The quotes of each side by level.
+}
+
+// NewMarketMaker creates a MarketMaker with the configuration.
+func NewMarketMaker(config MarketMakerConfig) *MarketMaker {
+	if config.Levels <= 0 {
+		config.Levels = 1
+	}
+
+	return &MarketMaker{
+		config: config,
+		quotes: map[string][]*quote{
+			model.LONG:  nil,
+			model.SHORT: nil,
+		},
+	}
+}
+
+// MarketMakerFactory returns a StrategyFactory creating a MarketMaker with the configuration for each market.
+func MarketMakerFactory(config MarketMakerConfig) StrategyFactory {
+	return func(marketId string) Strategy {
+		return NewMarketMaker(config)
+	}
+}
+
+// TimerInterval is a method that returns the requote interval.
+func (mm *MarketMaker) TimerInterval() time.Duration {
+	return mm.config.TimerInterval
+}
+
+// OnStart is a method that cancels quotes left in the market by earlier runs, orders of
+// other strategies and manual orders are left alone.
+func (mm *MarketMaker) OnStart(ctx *Context) error {
+	if ctx.ReadOnly() {
+		logrus.Infof("Market maker of %s is read-only, nothing will be quoted", ctx.MarketId())
+		return nil
+	}
+
+	if _, err := ctx.CancelTagged(); err != nil {
+		return fmt.Errorf("failed to cancel orders of %s: %w", ctx.MarketId(), err)
+	}
+
+	return nil
+}
+
+// OnMarket is a method that requotes on market data.
+func (mm *MarketMaker) OnMarket(ctx *Context, market *model.MarketData) {
+	mm.requote(ctx)
+}
+
+// OnOrderbook is a method that is called on orderbook updates, quotes follow market data.
+func (mm *MarketMaker) OnOrderbook(ctx *Context, update *model.OrderbookData) {}
+
+// OnTrade is a method that is called on trades.
+func (mm *MarketMaker) OnTrade(ctx *Context, trade *model.TradeData) {}
+
+// OnAccount is a method that is called on account updates, the position is read from the context.
+func (mm *MarketMaker) OnAccount(ctx *Context, profile *model.ProfileData) {}
+
+// OnOrderUpdate is a method that forgets finished quotes and tracks partially filled ones.
+func (mm *MarketMaker) OnOrderUpdate(ctx *Context, order *model.OrderData) {
+	level, q := mm.find(order.Side, order.OrderId)
+	if q == nil {
+		return
+	}
+
+	switch order.Status {
+	case model.CLOSED, model.CANCELED, model.REJECTED:
+		mm.quotes[order.Side][level] = nil
+	default:
+		switch {
+		case order.TotalFilledSize != nil:
+			q.filled = *order.TotalFilledSize
+		case order.InitialSize != nil && order.Size != nil:
+			q.filled = order.InitialSize.Sub(*order.Size)
+		}
+	}
+}
+
+// OnTimer is a method that requotes, e.g. after a refused order or a position change.
+func (mm *MarketMaker) OnTimer(ctx *Context) {
+	mm.requote(ctx)
+}
+
+// OnStreamEvent is a method that pulls quotes which can no longer be trusted.
+func (mm *MarketMaker) OnStreamEvent(ctx *Context, event StreamEvent) {
+	switch event.Type {
+	case STREAM_DISCONNECTED:
+		// Quotes stay tracked, the dead man's switch cancels them if the connection stays lost.
+	case STREAM_CONNECTED:
+		// The orders were reloaded, the dead man's switch may have canceled the quotes.
+		mm.syncQuotes(ctx)
+	case STREAM_STALE:
+		mm.cancelQuotes(ctx)
+	case STREAM_GAP:
+		// Fills and cancels of the quotes may be lost.
+		if strings.HasPrefix(event.Channel, stream.ACCOUNT_PREFIX) {
+			mm.cancelQuotes(ctx)
+		}
+	}
+}
+
+// OnStop is a method that cancels the quotes.
+func (mm *MarketMaker) OnStop(ctx *Context) {
+	mm.cancelQuotes(ctx)
+}
+
+// requote moves the quotes of both sides to the wanted prices and sizes.
+func (mm *MarketMaker) requote(ctx *Context) {
+	if ctx.ReadOnly() || ctx.Paused() {
+		return
+	}
+
+	market, err := ctx.Market()
+	if err != nil {
+		logrus.Error("Failed to get market: ", err)
+		return
+	}
+
+	fair := fairPrice(market)
+	if !fair.IsPositive() {
+		return
+	}
+
+	size := mm.config.Size
+	if !size.IsPositive() {
+		if market.MinOrder == nil {
+			logrus.Errorf("Minimum order is unknown for market %s", ctx.MarketId())
+			return
+		}
+		size = *market.MinOrder
+	}
+
+	tick := decimal.Zero
+	if market.MinTick != nil {
+		tick = *market.MinTick
+	}
+
+	position := signedPosition(ctx.Position())
+	for _, side := range []string{model.LONG, model.SHORT} {
+		var prices []decimal.Decimal
+		if mm.canQuote(side, position) {
+			prices = mm.prices(side, fair, position, tick, market)
+		}
+
+		mm.quoteSide(ctx, side, prices, size)
+	}
+}
+
+// prices returns the wanted quote prices of the side from the best level outwards.
+// Quotes are never put on the other side of the book, post-only orders would be rejected.
+// A crossing level is moved one tick off the touch, it is skipped if the tick is unknown.
+func (mm *MarketMaker) prices(side string, fair, position, tick decimal.Decimal, market model.MarketData) []decimal.Decimal {
+	one := decimal.NewFromInt(1)
+	half := mm.config.Spread.Div(decimal.NewFromInt(2))
+	center := fair.Mul(one.Sub(mm.config.Skew.Mul(mm.inventoryRatio(position))))
+
+	prices := make([]decimal.Decimal, 0, mm.config.Levels)
+	for level := 0; level < mm.config.Levels; level++ {
+		offset := half.Add(mm.config.LevelSpacing.Mul(decimal.NewFromInt(int64(level))))
+
+		var price decimal.Decimal
+		if side == model.LONG {
+			price = client.FloorToTick(center.Mul(one.Sub(offset)), tick)
+			if market.BestAsk != nil && market.BestAsk.IsPositive() && price.GreaterThanOrEqual(*market.BestAsk) {
+				if !tick.IsPositive() {
+					continue
+				}
+				price = market.BestAsk.Sub(tick)
+			}
+		} else {
+			price = client.SnapToTick(center.Mul(one.Add(offset)), tick)
+			if market.BestBid != nil && market.BestBid.IsPositive() && price.LessThanOrEqual(*market.BestBid) {
+				if !tick.IsPositive() {
+					continue
+				}
+				price = market.BestBid.Add(tick)
+			}
+		}
+
+		if price.IsPositive() {
+			prices = append(prices, price)
+		}
+	}
+
+	return prices
+}
+
+// quoteSide places, amends or cancels the quotes of the side to match the prices.
+func (mm *MarketMaker) quoteSide(ctx *Context, side string, prices []decimal.Decimal, size decimal.Decimal) {
+	quotes := mm.quotes[side]
+	for len(quotes) < len(prices) {
+		quotes = append(quotes, nil)
+	}
+
+	for level, q := range quotes {
+		if level >= len(prices) {
+			if q != nil && mm.cancel(ctx, q) {
+				quotes[level] = nil
+			}
+			continue
+		}
+
+		price := prices[level]
+		switch {
+		case q == nil:
+			quotes[level] = mm.place(ctx, side, price, size)
+		case mm.near(q.price, price) && q.size.Equal(size):
+		default:
+			quotes[level] = mm.amend(ctx, side, q, price, size)
+		}
+	}
+
+	// Drop trailing empty levels.
+	for len(quotes) > 0 && quotes[len(quotes)-1] == nil {
+		quotes = quotes[:len(quotes)-1]
+	}
+	mm.quotes[side] = quotes
+}
+
+// place sends a new post-only quote and returns it, nil if it was not placed.
+func (mm *MarketMaker) place(ctx *Context, side string, price, size decimal.Decimal) *quote {
+	req, err := client.Limit(ctx.MarketId(), side, price, size).
+		PostOnly().
+		ClientID(ctx.NextClientOrderId()).
+		Build()
+	if err != nil {
+		logrus.Error("Invalid quote: ", err)
+		return nil
+	}
+
+	order, err := ctx.PlaceOrder(req)
+	if err != nil {
+		logQuoteError("Failed to place quote", err)
+		return nil
+	}
+
+	if order.Status == model.REJECTED {
+		return nil
+	}
+
+	return &quote{orderId: order.OrderId, price: price, size: size}
+}
+
+// amend moves the quote and returns it, nil if it had to be canceled. The size is sent only
+// if the wanted size changed, as the new remaining size after the fills of the quote.
+func (mm *MarketMaker) amend(ctx *Context, side string, q *quote, price, size decimal.Decimal) *quote {
+	req := &client.DecimalOrderAmendRequest{
+		OrderId:  q.orderId,
+		MarketId: ctx.MarketId(),
+		Price:    &price,
+	}
+	if !q.size.Equal(size) {
+		remaining := size.Sub(q.filled)
+		if !remaining.IsPositive() {
+			// The fills already reached the wanted size.
+			if mm.cancel(ctx, q) {
+				return nil
+			}
+			return q
+		}
+		req.Size = &remaining
+	}
+
+	_, err := ctx.AmendOrder(side, req)
+	if err == nil {
+		q.price, q.size = price, size
+		return q
+	}
+
+	logQuoteError("Failed to amend quote", err)
+
+	// A quote which cannot be moved must not rest at a wrong price, it is replaced on the next requote.
+	if errors.Is(err, ErrPaused) || !mm.cancel(ctx, q) {
+		return q
+	}
+
+	return nil
+}
+
+// cancel cancels the quote and reports whether it is gone.
+func (mm *MarketMaker) cancel(ctx *Context, q *quote) bool {
+	if err := ctx.CancelOrder(q.orderId); err != nil {
+		logQuoteError("Failed to cancel quote", err)
+		return false
+	}
+
+	return true
+}
+
+// cancelQuotes cancels the quotes of both sides.
+func (mm *MarketMaker) cancelQuotes(ctx *Context) {
+	if ctx.ReadOnly() {
+		return
+	}
+
+	for side, quotes := range mm.quotes {
+		for level, q := range quotes {
+			if q != nil && mm.cancel(ctx, q) {
+				quotes[level] = nil
+			}
+		}
+		mm.quotes[side] = quotes
+	}
+}
+
+// syncQuotes drops the quotes whose orders are known to be finished and cancels
+// the quotes whose orders are no longer tracked, so no quote is forgotten while it may rest.
+func (mm *MarketMaker) syncQuotes(ctx *Context) {
+	orders := ctx.Orders()
+	for side, quotes := range mm.quotes {
+		for level, q := range quotes {
+			if q == nil {
+				continue
+			}
+
+			status, ok := orders[q.orderId]
+			switch {
+			case ok && (status == model.CLOSED || status == model.CANCELED || status == model.REJECTED):
+				quotes[level] = nil
+			case !ok && !ctx.ReadOnly() && mm.cancel(ctx, q):
+				quotes[level] = nil
+			}
+		}
+		mm.quotes[side] = quotes
+	}
+}
+
+// find returns the level and quote of the order, nil if it is not a quote.
+func (mm *MarketMaker) find(side, orderId string) (int, *quote) {
+	for level, q := range mm.quotes[side] {
+		if q != nil && q.orderId == orderId {
+			return level, q
+		}
+	}
+
+	return 0, nil
+}
+
+// canQuote reports whether the side may quote, a side adding to a position at MaxPosition may not.
+func (mm *MarketMaker) canQuote(side string, position decimal.Decimal) bool {
+	limit := mm.config.MaxPosition
+	if !limit.IsPositive() {
+		return true
+	}
+
+	if side == model.LONG {
+		return position.LessThan(limit)
+	}
+
+	return position.GreaterThan(limit.Neg())
+}
+
+// inventoryRatio returns the position relative to MaxPosition between -1 and 1, 0 without limit.
+func (mm *MarketMaker) inventoryRatio(position decimal.Decimal) decimal.Decimal {
+	limit := mm.config.MaxPosition
+	if !limit.IsPositive() {
+		return decimal.Zero
+	}
+
+	one := decimal.NewFromInt(1)
+	ratio := position.Div(limit)
+	if ratio.GreaterThan(one) {
+		return one
+	}
+	if ratio.LessThan(one.Neg()) {
+		return one.Neg()
+	}
+
+	return ratio
+}
+
+// near reports whether the quote price is within tolerance of the wanted price.
+func (mm *MarketMaker) near(current, wanted decimal.Decimal) bool {
+	if current.Equal(wanted) {
+		return true
+	}
+
+	return current.Sub(wanted).Abs().LessThanOrEqual(wanted.Mul(mm.config.Tolerance))
+}
+
+// fairPrice returns the fair price of the market, the mid price or the market price if it is unknown.
+func fairPrice(market model.MarketData) decimal.Decimal {
+	if market.FairPrice != nil && market.FairPrice.IsPositive() {
+		return *market.FairPrice
+	}
+
+	if market.BestBid != nil && market.BestAsk != nil && market.BestBid.IsPositive() && market.BestAsk.IsPositive() {
+		return market.BestBid.Add(*market.BestAsk).Div(decimal.NewFromInt(2))
+	}
+
+	if market.MarketPrice != nil {
+		return *market.MarketPrice
+	}
+
+	return decimal.Zero
+}
+
+// logQuoteError logs an order error, refusals of the context are expected and logged quietly.
+func logQuoteError(msg string, err error) {
+	if errors.Is(err, ErrPaused) || errors.Is(err, ErrRiskLimit) {
+		logrus.Debugf("%s: %s", msg, err)
+		return
+	}
+
+	logrus.Errorf("%s: %s", msg, err)
+}
@@ -0,0 +1,297 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"rabbitx-client/client"
+	"rabbitx-client/model"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// fakeOrders serves the markets and the order requests of a market maker, logging the requests.
+type fakeOrders struct {
+	mu     sync.Mutex
+	open   map[string]string // The client order IDs of the open orders by order ID.
+	calls  []string
+	lastId int
+}
+
+// ServeHTTP implements http.Handler.
+func (f *fakeOrders) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == client.PATH_MARKETS {
+		w.Write([]byte(`{"success":true,"error":"","result":[{"id":"BTC-USD","status":"active","min_tick":"0.5","min_order":"0.001"}]}`))
+		return
+	}
+	if r.URL.Path != client.PATH_ORDERS {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		orders := []model.OrderData{}
+		for id, clientId := range f.open {
+			clientId := clientId
+			orders = append(orders, model.OrderData{OrderId: id, MarketID: "BTC-USD", Status: model.OPEN, ClientOrderId: &clientId})
+		}
+		json.NewEncoder(w).Encode(client.Response[model.OrderData]{Success: true, Result: orders})
+		return
+	}
+
+	var req struct {
+		OrderId       string           `json:"order_id"`
+		ClientOrderId string           `json:"client_order_id"`
+		Price         decimal.Decimal  `json:"price"`
+		Size          *decimal.Decimal `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		f.lastId++
+		req.OrderId = fmt.Sprint(f.lastId)
+		f.open[req.OrderId] = req.ClientOrderId
+		f.calls = append(f.calls, "create "+req.Price.String())
+	case http.MethodPut:
+		call := "amend " + req.OrderId + " " + req.Price.String()
+		if req.Size != nil {
+			call += " size " + req.Size.String()
+		}
+		f.calls = append(f.calls, call)
+	case http.MethodDelete:
+		if _, ok := f.open[req.OrderId]; !ok {
+			w.Write([]byte(`{"success":false,"error":"order not found","result":[]}`))
+			return
+		}
+		delete(f.open, req.OrderId)
+		f.calls = append(f.calls, "cancel "+req.OrderId)
+		w.Write([]byte(fmt.Sprintf(`{"success":true,"error":"","result":[{"id":%q,"status":"canceled"}]}`, req.OrderId)))
+		return
+	}
+
+	w.Write([]byte(fmt.Sprintf(`{"success":true,"error":"","result":[{"id":%q,"status":"open"}]}`, req.OrderId)))
+}
+
+// callLog returns the order requests received since the last call.
+func (f *fakeOrders) callLog() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := f.calls
+	f.calls = nil
+
+	return calls
+}
+
+// newTestMarketMaker returns a market maker and the context of its watchdog trading on a fake exchange.
+func newTestMarketMaker(t *testing.T, config MarketMakerConfig) (*MarketMaker, *Context, *fakeOrders) {
+	t.Helper()
+
+	f := &fakeOrders{open: map[string]string{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	expires := time.Now().Add(24 * time.Hour).Unix()
+	c := client.NewRbClient(server.URL, "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", "", "key", "0x01", "token", "", expires)
+
+	mm := NewMarketMaker(config)
+	wd := NewWatchDog(c, nil, "BTC-USD", mm, RiskLimits{}, nil, make(chan struct{}))
+	idGen, err := client.NewClientOrderIdGenerator(STRATEGY_TAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd.idGen = idGen
+
+	return mm, wd.ctx, f
+}
+
+// decimals parses the values.
+func decimals(values ...string) []decimal.Decimal {
+	res := make([]decimal.Decimal, 0, len(values))
+	for _, value := range values {
+		res = append(res, decimal.RequireFromString(value))
+	}
+
+	return res
+}
+
+// assertPrices fails the test if the prices differ from the wanted ones.
+func assertPrices(t *testing.T, name string, got []decimal.Decimal, want ...string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+		return
+	}
+	for i, price := range decimals(want...) {
+		if !got[i].Equal(price) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestMarketMakerPricesSkew(t *testing.T) {
+	mm := NewMarketMaker(MarketMakerConfig{
+		Spread:       decimal.RequireFromString("0.002"),
+		LevelSpacing: decimal.RequireFromString("0.001"),
+		Levels:       2,
+		MaxPosition:  decimal.RequireFromString("1"),
+		Skew:         decimal.RequireFromString("0.01"),
+	})
+	fair := decimal.RequireFromString("10000")
+	tick := decimal.RequireFromString("0.5")
+
+	assertPrices(t, "flat bids", mm.prices(model.LONG, fair, decimal.Zero, tick, model.MarketData{}), "9990", "9980")
+	assertPrices(t, "flat asks", mm.prices(model.SHORT, fair, decimal.Zero, tick, model.MarketData{}), "10010", "10020")
+
+	// Half the maximum long position moves the quotes down by half the skew.
+	long := decimal.RequireFromString("0.5")
+	assertPrices(t, "long bids", mm.prices(model.LONG, fair, long, tick, model.MarketData{}), "9940", "9930")
+	assertPrices(t, "long asks", mm.prices(model.SHORT, fair, long, tick, model.MarketData{}), "9960", "9970")
+
+	// The skew is capped at the maximum position.
+	short := decimal.RequireFromString("-3")
+	assertPrices(t, "short bids", mm.prices(model.LONG, fair, short, tick, model.MarketData{}), "10089.5", "10079.5")
+}
+
+func TestMarketMakerPricesClamp(t *testing.T) {
+	mm := NewMarketMaker(MarketMakerConfig{
+		Spread:       decimal.RequireFromString("0.002"),
+		LevelSpacing: decimal.RequireFromString("0.001"),
+		Levels:       2,
+	})
+	fair := decimal.RequireFromString("10000")
+	tick := decimal.RequireFromString("0.5")
+	bestAsk := decimal.RequireFromString("9985")
+	bestBid := decimal.RequireFromString("10015")
+	market := model.MarketData{BestBid: &bestBid, BestAsk: &bestAsk}
+
+	// Crossing levels move one tick off the touch.
+	assertPrices(t, "bids", mm.prices(model.LONG, fair, decimal.Zero, tick, market), "9984.5", "9980")
+	assertPrices(t, "asks", mm.prices(model.SHORT, fair, decimal.Zero, tick, market), "10015.5", "10020")
+
+	// Without a tick they would rest on the touch, so they are skipped.
+	assertPrices(t, "bids without tick", mm.prices(model.LONG, fair, decimal.Zero, decimal.Zero, market), "9980")
+	assertPrices(t, "asks without tick", mm.prices(model.SHORT, fair, decimal.Zero, decimal.Zero, market), "10020")
+}
+
+func TestMarketMakerQuoteSide(t *testing.T) {
+	mm, ctx, f := newTestMarketMaker(t, MarketMakerConfig{Tolerance: decimal.RequireFromString("0.0002")})
+	size := decimal.RequireFromString("0.001")
+
+	mm.quoteSide(ctx, model.LONG, decimals("9990", "9980"), size)
+	if want := []string{"create 9990", "create 9980"}; !reflect.DeepEqual(f.callLog(), want) {
+		t.Fatalf("requests of the first quote differ from %v", want)
+	}
+
+	// Moves within tolerance leave the quotes in place.
+	mm.quoteSide(ctx, model.LONG, decimals("9990.5", "9979.5"), size)
+	if calls := f.callLog(); len(calls) != 0 {
+		t.Errorf("requests within tolerance = %v, want none", calls)
+	}
+
+	// A moved level is amended, a level no longer wanted is canceled.
+	mm.quoteSide(ctx, model.LONG, decimals("9950"), size)
+	if want, got := []string{"amend 1 9950", "cancel 2"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+	if quotes := mm.quotes[model.LONG]; len(quotes) != 1 || quotes[0].orderId != "1" || !quotes[0].price.Equal(decimal.RequireFromString("9950")) {
+		t.Errorf("quotes = %+v, want order 1 at 9950", quotes)
+	}
+
+	// A level emptied by a fill is placed again.
+	mm.OnOrderUpdate(ctx, &model.OrderData{OrderId: "1", Side: model.LONG, Status: model.CLOSED})
+	mm.quoteSide(ctx, model.LONG, decimals("9950"), size)
+	if want, got := []string{"create 9950"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests after fill = %v, want %v", got, want)
+	}
+}
+
+func TestMarketMakerSyncQuotes(t *testing.T) {
+	mm, ctx, f := newTestMarketMaker(t, MarketMakerConfig{})
+	size := decimal.RequireFromString("0.001")
+
+	mm.quoteSide(ctx, model.LONG, decimals("9990", "9980", "9970"), size)
+	f.callLog()
+
+	// The reloaded orders: 1 rests, 2 was canceled by the dead man's switch and 3 is not listed.
+	ctx.wd.muOrder.Lock()
+	ctx.wd.orders = map[string]string{"1": model.OPEN, "2": model.CANCELED}
+	ctx.wd.muOrder.Unlock()
+
+	mm.OnStreamEvent(ctx, StreamEvent{Type: STREAM_CONNECTED})
+
+	if want, got := []string{"cancel 3"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+	if quotes := mm.quotes[model.LONG]; len(quotes) != 3 || quotes[0] == nil || quotes[1] != nil || quotes[2] != nil {
+		t.Errorf("quotes = %+v, want only order 1", quotes)
+	}
+}
+
+func TestMarketMakerPartialFill(t *testing.T) {
+	mm, ctx, f := newTestMarketMaker(t, MarketMakerConfig{})
+	size := decimal.RequireFromString("0.003")
+	remaining := decimal.RequireFromString("0.002")
+	filled := decimal.RequireFromString("0.001")
+
+	mm.quoteSide(ctx, model.LONG, decimals("9990"), size)
+	f.callLog()
+
+	// A partial fill does not make the quote differ from the wanted size.
+	mm.OnOrderUpdate(ctx, &model.OrderData{OrderId: "1", Side: model.LONG, Status: model.OPEN, Size: &remaining, TotalFilledSize: &filled})
+	mm.quoteSide(ctx, model.LONG, decimals("9990"), size)
+	if calls := f.callLog(); len(calls) != 0 {
+		t.Errorf("requests after partial fill = %v, want none", calls)
+	}
+
+	// A price move keeps the remaining size.
+	mm.quoteSide(ctx, model.LONG, decimals("9950"), size)
+	if want, got := []string{"amend 1 9950"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests after price move = %v, want %v", got, want)
+	}
+
+	// A new wanted size is sent net of the fills.
+	mm.quoteSide(ctx, model.LONG, decimals("9950"), decimal.RequireFromString("0.005"))
+	if want, got := []string{"amend 1 9950 size 0.004"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests after size change = %v, want %v", got, want)
+	}
+
+	// The fills already exceed a smaller wanted size, the quote is replaced.
+	mm.quoteSide(ctx, model.LONG, decimals("9950"), decimal.RequireFromString("0.001"))
+	if want, got := []string{"cancel 1"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests after size decrease = %v, want %v", got, want)
+	}
+}
+
+func TestMarketMakerOnStartCancelsTaggedOrders(t *testing.T) {
+	mm, ctx, f := newTestMarketMaker(t, MarketMakerConfig{})
+
+	f.mu.Lock()
+	f.open = map[string]string{
+		"7": STRATEGY_TAG + "-0badf00d-3",
+		"8": "manual-1",
+		"9": "",
+	}
+	f.mu.Unlock()
+
+	if err := mm.OnStart(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"cancel 7"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
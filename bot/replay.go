@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"errors"
+	"rabbitx-client/client"
+	"rabbitx-client/model"
+	"rabbitx-client/orderbook"
+	"rabbitx-client/stream"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errReplaySnapshot is returned for orderbook snapshots requested during replay before the recorded one.
+var errReplaySnapshot = errors.New("no recorded orderbook snapshot to replay")
+
+// Replay is a method of DummyBot that feeds a recording through the data handlers of the markets.
+// Publications take the same EventData path as in Run and reach the strategies, but nothing
+// is traded and nothing is loaded over REST, so a recorded session behaves the same on every replay.
+// Books are synced from the orderbook snapshots recorded when the live books synced.
+// Strategy timers do not run during replay.
+// Publications of other markets are skipped.
+func (b *DummyBot) Replay(replayer *stream.Replayer, options stream.ReplayOptions, marketIds ...string) error {
+	if len(marketIds) == 0 {
+		return errors.New("at least one market is required")
+	}
+
+	// The mirror is only fed by recorded account updates.
+	b.account = client.NewAccountMirror(b.client, client.DEFAULT_RECONCILE_INTERVAL)
+	b.createWatchdogs(marketIds)
+
+	// Each recorded snapshot syncs the book once, as it did in the recorded session.
+	snapshots := make(map[string]*model.OrderbookData)
+	for _, wd := range b.allWatchdogs() {
+		wd.book = orderbook.New(wd.marketId, func(marketId string) (*model.OrderbookData, error) {
+			snapshot, ok := snapshots[marketId]
+			if !ok {
+				return nil, errReplaySnapshot
+			}
+			delete(snapshots, marketId)
+
+			return snapshot, nil
+		})
+
+		// Strategies see the recorded data, their orders are refused.
+		wd.readOnly = true
+		if err := wd.start(); err != nil {
+			return err
+		}
+		defer wd.strategy.OnStop(wd.ctx)
+	}
+
+	return replayer.Run(options, func(p stream.Publication) {
+		data := EventData{WsChannel: p.Channel, Data: p.Data}
+
+		if strings.HasPrefix(p.Channel, stream.SNAPSHOT_PREFIX+stream.ORDERBOOK_PREFIX) {
+			marketId := strings.TrimPrefix(p.Channel, stream.SNAPSHOT_PREFIX+stream.ORDERBOOK_PREFIX)
+			wd, ok := b.watchdogs[marketId]
+			if !ok {
+				return
+			}
+
+			snapshot := decodeAndPrintData[model.OrderbookData](p.Channel, p.Data, false)
+			if snapshot == nil {
+				return
+			}
+
+			snapshots[marketId] = snapshot
+			if err := wd.book.Resync(); err != nil {
+				logrus.Warnf("Orderbook %s: %s", marketId, err)
+			}
+			return
+		}
+
+		if strings.HasPrefix(p.Channel, stream.ACCOUNT_PREFIX) {
+			if err := b.account.ApplyJSON(p.Data); err != nil {
+				logrus.Errorf("Failed to apply account update: %s", err)
+			}
+
+			for _, marketId := range b.marketIds {
+				b.watchdogs[marketId].handleData(data, displayChannels)
+			}
+			return
+		}
+
+		for marketId, wd := range b.watchdogs {
+			if strings.HasSuffix(p.Channel, ":"+marketId) {
+				wd.handleData(data, displayChannels)
+			}
+		}
+	})
+}
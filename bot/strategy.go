@@ -5,6 +5,8 @@ package bot
 import (
 	"rabbitx-client/client"
 	"rabbitx-client/model"
+	"rabbitx-client/orderbook"
+	"rabbitx-client/stream"
 	"strings"
 	"sync"
 	"time"
@@ -14,58 +16,205 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-// Constants for default market ID, price tick and size tick.
+// Constants for default market ID, the tag of client order IDs and the default timer interval.
 const (
-	DEFAULT_MARKET_ID  = "ETH-USD"
-	DEFAULT_PRICE_TICK = 0.1
-	DEFAULT_SIZE_TICK  = 0.001
+	DEFAULT_MARKET_ID      = "ETH-USD"
+	STRATEGY_TAG           = "dummy"
+	DEFAULT_TIMER_INTERVAL = 3 * time.Second
 )
 
-// EventData struct holds the websocket channel and data.
+// Strategy is the trading logic of one market. A WatchDog calls it from a single
+// goroutine, so callbacks never run concurrently and must not block for long.
+// Orders are sent through the Context, which applies pause state and risk limits.
+type Strategy interface {
+	OnStart(ctx *Context) error                            // Called once before any event.
+	OnMarket(ctx *Context, market *model.MarketData)       // Called on market: channel updates.
+	OnOrderbook(ctx *Context, update *model.OrderbookData) // Called after the update is applied to ctx.Book().
+	OnTrade(ctx *Context, trade *model.TradeData)          // Called on trade: channel updates.
+	OnAccount(ctx *Context, profile *model.ProfileData)    // Called on account@ channel updates.
+	OnOrderUpdate(ctx *Context, order *model.OrderData)    // Called for each order of the market in account updates.
+	OnTimer(ctx *Context)                                  // Called every timer interval.
+	OnStop(ctx *Context)                                   // Called once when the WatchDog stops.
+}
+
+// StreamEventHandler is implemented by strategies which react to connection state,
+// e.g. to pull quotes while disconnected.
+type StreamEventHandler interface {
+	OnStreamEvent(ctx *Context, event StreamEvent)
+}
+
+// TimerIntervaler is implemented by strategies which need a timer interval
+// other than DEFAULT_TIMER_INTERVAL.
+type TimerIntervaler interface {
+	TimerInterval() time.Duration
+}
+
+// StrategyFactory creates the strategy of a market.
+type StrategyFactory func(marketId string) Strategy
+
+// displayChannels lists the channels whose data is printed.
+var displayChannels = []string{"account"}
+
+// EventData struct holds the websocket channel and raw JSON data.
 type EventData struct {
 	WsChannel string
-	Data      interface{}
+	Data      []byte
+}
+
+// Stream event types.
+const (
+	// STREAM_CONNECTED means the websocket connection is established again.
+	STREAM_CONNECTED = "connected"
+
+	// STREAM_DISCONNECTED means the websocket connection is lost.
+	STREAM_DISCONNECTED = "disconnected"
+
+	// STREAM_GAP means publications of a channel were missed and could not be recovered.
+	STREAM_GAP = "gap"
+
+	// STREAM_STALE means a channel stopped delivering publications.
+	STREAM_STALE = "stale"
+
+	// STREAM_FRESH means a stale channel delivers publications again.
+	STREAM_FRESH = "fresh"
+)
+
+// StreamEvent struct holds a change of the websocket connection state.
+type StreamEvent struct {
+	Type    string // The type of the event.
+	Channel string // The channel with a gap or changed liveness, empty for connection events.
 }
 
-// WatchDog struct holds the market ID, client, orders, data channel, done channel, best bid and best ask.
+// WatchDog struct holds the market ID, client, orders, account mirror, data channel, the pending
+// stream events with the channel signaling them, done channel, best bid, best ask, the reasons quoting is paused for, whether it trades at all,
+// the dead man's switch it sends heartbeats to, the local orderbook, the strategy with its context and the channel closed when the listener stops.
 type WatchDog struct {
 	marketId string
 	muOrder  sync.RWMutex
 	client   *client.RbClient
 	orders   map[string]string
+	account  *client.AccountMirror
 	dataCh   chan EventData
+	eventCh  chan struct{}
+	muEvent  sync.Mutex
+	pending  map[string]StreamEvent
+	queued   []string
 	done     chan struct{}
 	muMarket sync.RWMutex
 	bestBid  decimal.Decimal
 	bestAsk  decimal.Decimal
+	pausedBy map[string]bool
+	readOnly bool
+	deadMan  *client.DeadManSwitch
+	idGen    *client.ClientOrderIdGenerator
+	book     *orderbook.Book
+	strategy Strategy
+	ctx      *Context
+	stopped  chan struct{}
 }
 
-// NewWatchDog function initializes a new WatchDog.
-func NewWatchDog(client *client.RbClient, marketId string, dataCh chan EventData, done chan struct{}) *WatchDog {
-	return &WatchDog{
+// NewWatchDog function initializes a new WatchDog running the strategy within the risk limits.
+func NewWatchDog(client *client.RbClient, account *client.AccountMirror, marketId string, strategy Strategy, limits RiskLimits, dataCh chan EventData, done chan struct{}) *WatchDog {
+	wd := &WatchDog{
 		marketId: marketId,
 		client:   client,
+		account:  account,
 		dataCh:   dataCh,
+		eventCh:  make(chan struct{}, 1),
+		pending:  make(map[string]StreamEvent),
 		done:     done,
 		orders:   make(map[string]string),
+		pausedBy: make(map[string]bool),
+		book:     orderbook.New(marketId, client.GetOrderbook),
+		strategy: strategy,
 	}
+	wd.ctx = &Context{wd: wd, limits: limits}
+
+	return wd
 }
 
-// Run function starts the WatchDog.
+// Notify function delivers a stream event to the listener without blocking, it is called
+// from the websocket event loop. Pending events of the same kind and channel are coalesced,
+// the listener sees the latest one at the position of the first.
+func (wd *WatchDog) Notify(event StreamEvent) {
+	key := streamEventKey(event)
+
+	wd.muEvent.Lock()
+	if _, ok := wd.pending[key]; !ok {
+		wd.queued = append(wd.queued, key)
+	}
+	wd.pending[key] = event
+	wd.muEvent.Unlock()
+
+	select {
+	case wd.eventCh <- struct{}{}:
+	default:
+	}
+}
+
+// takeEvents function returns the pending stream events in the order they were first notified.
+func (wd *WatchDog) takeEvents() []StreamEvent {
+	wd.muEvent.Lock()
+	defer wd.muEvent.Unlock()
+
+	events := make([]StreamEvent, 0, len(wd.queued))
+	for _, key := range wd.queued {
+		events = append(events, wd.pending[key])
+		delete(wd.pending, key)
+	}
+	wd.queued = wd.queued[:0]
+
+	return events
+}
+
+// streamEventKey function returns the key coalescing the event: connection events replace
+// each other, as do the liveness events of a channel and its gaps.
+func streamEventKey(event StreamEvent) string {
+	switch event.Type {
+	case STREAM_CONNECTED, STREAM_DISCONNECTED:
+		return "connection"
+	case STREAM_STALE, STREAM_FRESH:
+		return "liveness:" + event.Channel
+	default:
+		return event.Type + ":" + event.Channel
+	}
+}
+
+// Run function starts the WatchDog. A read-only WatchDog does not load orders,
+// its strategy sees market data but cannot trade.
 func (wd *WatchDog) Run() error {
-	err := wd.loadOrders()
-	if err != nil {
+	if err := wd.start(); err != nil {
 		return err
 	}
 
-	go wd.listener([]string{"account"})
+	wd.stopped = make(chan struct{})
+	go wd.listener(displayChannels)
 
-	cancelCh := make(chan string, 10000)
-	go wd.strategy(cancelCh)
+	return nil
+}
 
-	go wd.monitorOrders(cancelCh)
+// Wait function waits until the listener of a running WatchDog has stopped its strategy.
+func (wd *WatchDog) Wait() {
+	if wd.stopped != nil {
+		<-wd.stopped
+	}
+}
 
-	return nil
+// start function prepares the WatchDog and starts the strategy.
+func (wd *WatchDog) start() error {
+	idGen, err := client.NewClientOrderIdGenerator(STRATEGY_TAG)
+	if err != nil {
+		return err
+	}
+	wd.idGen = idGen
+
+	if !wd.readOnly {
+		if err := wd.loadOrders(); err != nil {
+			return err
+		}
+	}
+
+	return wd.strategy.OnStart(wd.ctx)
 }
 
 // loadOrders function loads the orders from the client.
@@ -88,85 +237,40 @@ func (wd *WatchDog) loadOrders() error {
 	return nil
 }
 
-// strategy function runs the trading strategy.
-func (wd *WatchDog) strategy(cancelCh chan string) {
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
-
-	go wd.cancelOrders(cancelCh)
-
-	for {
-		select {
-		case <-ticker.C:
-			wd.placeOrder()
-		case <-wd.done:
-			return
-		}
-	}
-}
-
-// placeOrder function places an order.
-func (wd *WatchDog) placeOrder() {
-	wd.muMarket.RLock()
-	price := wd.bestBid.Mul(decimal.NewFromFloat(0.94))
-	wd.muMarket.RUnlock()
-
-	if price.LessThanOrEqual(decimal.Zero) {
-		return
-	}
-
-	order, err := wd.client.CreateOrder(&client.OrderCreateRequest{
-		MarketId: wd.marketId,
-		Type:     model.LIMIT,
-		Side:     model.LONG,
-		Price:    roundToNearestTick(price.InexactFloat64(), DEFAULT_PRICE_TICK),
-		Size:     roundToNearestTick(DEFAULT_SIZE_TICK, DEFAULT_SIZE_TICK),
-	})
-	if err != nil {
-		logrus.Error("Failed to create order: ", err)
-		return
-	}
-
+// setOrderStatus function tracks the status of an order.
+func (wd *WatchDog) setOrderStatus(orderId, status string) {
 	wd.muOrder.Lock()
-	wd.orders[order.OrderId] = order.Status
-	wd.muOrder.Unlock()
+	defer wd.muOrder.Unlock()
 
-	logrus.Infof("Order created id : %s", order.OrderId)
+	wd.orders[orderId] = status
 }
 
-// cancelOrders function cancels the orders.
-func (wd *WatchDog) cancelOrders(cancelCh chan string) {
-	for {
-		select {
-		case oid := <-cancelCh:
-			wd.cancelOrder(oid)
-		case <-wd.done:
-			return
+// cleanOrders function cleans the orders.
+func (wd *WatchDog) cleanOrders() {
+	wd.muOrder.Lock()
+	defer wd.muOrder.Unlock()
+	for id, status := range wd.orders {
+		if status == model.CANCELED {
+			delete(wd.orders, id)
 		}
 	}
 }
 
-// cancelOrder function cancels a specific order.
-func (wd *WatchDog) cancelOrder(oid string) {
-	order, err := wd.client.CancelOrder(&client.OrderCancelRequest{
-		OrderId:  oid,
-		MarketId: wd.marketId,
-	})
-	if err != nil {
-		logrus.Error("Failed to cancel order: ", err)
-		return
+// timerInterval function returns the timer interval of the strategy.
+func (wd *WatchDog) timerInterval() time.Duration {
+	if s, ok := wd.strategy.(TimerIntervaler); ok && s.TimerInterval() > 0 {
+		return s.TimerInterval()
 	}
 
-	wd.muOrder.Lock()
-	wd.orders[order.OrderId] = order.Status
-	wd.muOrder.Unlock()
-
-	logrus.Infof("Order created id : %s", order.OrderId)
+	return DEFAULT_TIMER_INTERVAL
 }
 
-// monitorOrders function monitors the orders.
-func (wd *WatchDog) monitorOrders(cancelCh chan string) {
-	ticker := time.NewTicker(5 * time.Second)
+// listener function starts the listener. All strategy callbacks are called from it.
+func (wd *WatchDog) listener(display []string) {
+	logrus.Info("listener started")
+	defer close(wd.stopped)
+
+	ticker := time.NewTicker(wd.timerInterval())
 	defer ticker.Stop()
 
 	cleanTicker := time.NewTicker(300 * time.Second)
@@ -174,51 +278,121 @@ func (wd *WatchDog) monitorOrders(cancelCh chan string) {
 
 	for {
 		select {
+		case data := <-wd.dataCh:
+			wd.handleData(data, display)
+		case <-wd.eventCh:
+			for _, event := range wd.takeEvents() {
+				wd.handleStreamEvent(event)
+			}
 		case <-ticker.C:
-			wd.checkOrders(cancelCh)
+			if wd.deadMan != nil {
+				wd.deadMan.HeartbeatFrom(wd.marketId)
+			}
+			wd.strategy.OnTimer(wd.ctx)
 		case <-cleanTicker.C:
 			wd.cleanOrders()
 		case <-wd.done:
+			wd.strategy.OnStop(wd.ctx)
+			logrus.Info("listener stopped")
 			return
 		}
 	}
 }
 
-// checkOrders function checks the orders.
-func (wd *WatchDog) checkOrders(cancelCh chan string) {
-	wd.muOrder.RLock()
-	defer wd.muOrder.RUnlock()
-	for id, status := range wd.orders {
-		if status == model.OPEN || status == model.CANCELING {
-			cancelCh <- id
+// handleStreamEvent function pauses order placement while disconnected or while
+// market data is stale and reconciles state after a gap. Resting orders are not
+// canceled on disconnect: the strategy decides in OnStreamEvent, and the dead man's
+// switch cancels them once the connection stays lost for its grace period. Orders are
+// reloaded on reconnect, their updates may have been missed while disconnected.
+func (wd *WatchDog) handleStreamEvent(event StreamEvent) {
+	switch event.Type {
+	case STREAM_DISCONNECTED:
+		logrus.Warnf("Disconnected, pausing order placement in %s", wd.marketId)
+		wd.setPaused(STREAM_DISCONNECTED, true)
+	case STREAM_CONNECTED:
+		if !wd.readOnly {
+			if err := wd.reloadOrders(); err != nil {
+				logrus.Errorf("Failed to reload orders in %s: %s", wd.marketId, err)
+			}
 		}
+		wd.setPaused(STREAM_DISCONNECTED, false)
+	case STREAM_GAP:
+		wd.reconcile(event.Channel)
+	case STREAM_STALE:
+		logrus.Warnf("Pausing order placement in %s, %s is stale", wd.marketId, event.Channel)
+		wd.setPaused(event.Channel, true)
+	case STREAM_FRESH:
+		logrus.Infof("%s is alive again", event.Channel)
+		wd.setPaused(event.Channel, false)
+	}
+
+	if handler, ok := wd.strategy.(StreamEventHandler); ok {
+		handler.OnStreamEvent(wd.ctx, event)
 	}
 }
 
-// cleanOrders function cleans the orders.
-func (wd *WatchDog) cleanOrders() {
-	wd.muOrder.Lock()
-	defer wd.muOrder.Unlock()
-	for id, status := range wd.orders {
-		if status == model.CANCELED {
-			delete(wd.orders, id)
-		}
+// setPaused function pauses or resumes order placement for the reason.
+// Orders are placed only when no reason is left.
+func (wd *WatchDog) setPaused(reason string, paused bool) {
+	wd.muMarket.Lock()
+	defer wd.muMarket.Unlock()
+
+	if paused {
+		wd.pausedBy[reason] = true
+	} else {
+		delete(wd.pausedBy, reason)
 	}
 }
 
-// listener function starts the listener.
-func (wd *WatchDog) listener(display []string) {
-	logrus.Info("listener started")
+// Position function returns the position of the market from the account mirror.
+func (wd *WatchDog) Position() (model.PositionData, bool) {
+	if wd.account == nil {
+		return model.PositionData{}, false
+	}
 
-	for {
-		select {
-		case data := <-wd.dataCh:
-			wd.handleData(data, display)
-		case <-wd.done:
-			logrus.Info("listener stopped")
-			return
+	return wd.account.Position(wd.marketId)
+}
+
+// reconcile function reloads over REST the state built from the channel.
+func (wd *WatchDog) reconcile(channel string) {
+	logrus.Infof("Reconciling %s state after gap in %s", wd.marketId, channel)
+
+	switch {
+	case strings.HasPrefix(channel, stream.MARKET_PREFIX):
+		if err := wd.client.Markets().Refresh(); err != nil {
+			logrus.Errorf("Failed to reload markets: %s", err)
+		}
+	case strings.HasPrefix(channel, stream.ORDERBOOK_PREFIX):
+		if err := wd.book.Resync(); err != nil {
+			logrus.Errorf("Failed to resync orderbook %s: %s", wd.marketId, err)
+		}
+	case strings.HasPrefix(channel, stream.ACCOUNT_PREFIX) && !wd.readOnly:
+		if err := wd.reloadOrders(); err != nil {
+			logrus.Errorf("Failed to reload orders in %s: %s", wd.marketId, err)
 		}
+
+		// Positions and balances are reconciled by the bot's account mirror.
+	}
+}
+
+// reloadOrders function replaces the tracked orders with the orders listed over REST.
+func (wd *WatchDog) reloadOrders() error {
+	orders, err := wd.client.ListOrders(&client.OrderListRequest{
+		MarketId: wd.marketId,
+	})
+	if err != nil {
+		return err
 	}
+
+	wd.muOrder.Lock()
+	defer wd.muOrder.Unlock()
+
+	wd.orders = make(map[string]string, len(orders))
+	for _, order := range orders {
+		wd.orders[order.OrderId] = order.Status
+	}
+
+	return nil
 }
 
 // handleData function handles the data from the listener.
@@ -244,9 +418,11 @@ func (wd *WatchDog) handleData(data EventData, display []string) {
 	case "account":
 		wd.handleAccountData(data, show)
 	case "orderbook":
-		decodeAndPrintData[model.OrderbookData](channel, data.Data.([]byte), show)
+		wd.handleOrderbookData(data, show)
 	case "trade":
-		decodeAndPrintData[model.TradeData](channel, data.Data.([]byte), show)
+		if res := decodeAndPrintData[model.TradeData](channel, data.Data, show); res != nil {
+			wd.strategy.OnTrade(wd.ctx, res)
+		}
 	default:
 		logrus.
 			WithField("channel", channel).
@@ -256,13 +432,14 @@ func (wd *WatchDog) handleData(data EventData, display []string) {
 
 // handleMarketData function handles the market data.
 func (wd *WatchDog) handleMarketData(data EventData, show bool) {
-	res := decodeAndPrintData[model.MarketData](data.WsChannel, data.Data.([]byte), show)
+	res := decodeAndPrintData[model.MarketData](data.WsChannel, data.Data, show)
 	if res == nil {
 		return
 	}
 
+	wd.client.Markets().Update(res)
+
 	wd.muMarket.Lock()
-	defer wd.muMarket.Unlock()
 
 	if res.BestAsk != nil && res.BestAsk.Abs().GreaterThan(decimal.Zero) {
 		wd.bestAsk = *res.BestAsk
@@ -271,18 +448,53 @@ func (wd *WatchDog) handleMarketData(data EventData, show bool) {
 	if res.BestBid != nil && res.BestBid.Abs().GreaterThan(decimal.Zero) {
 		wd.bestBid = *res.BestBid
 	}
+	wd.muMarket.Unlock()
+
+	wd.strategy.OnMarket(wd.ctx, res)
+}
+
+// handleOrderbookData function applies the orderbook update to the local book.
+func (wd *WatchDog) handleOrderbookData(data EventData, show bool) {
+	res := decodeAndPrintData[model.OrderbookData](data.WsChannel, data.Data, show)
+	if res == nil {
+		return
+	}
+
+	if err := wd.book.Apply(res); err != nil {
+		logrus.Warnf("Orderbook %s: %s", wd.marketId, err)
+	}
+
+	wd.strategy.OnOrderbook(wd.ctx, res)
 }
 
 // handleAccountData function handles the account data.
 func (wd *WatchDog) handleAccountData(data EventData, show bool) {
-	res := decodeAndPrintData[model.ProfileData](data.WsChannel, data.Data.([]byte), show)
+	res := decodeAndPrintData[model.ProfileData](data.WsChannel, data.Data, show)
 	if res == nil {
 		return
 	}
 
-	wd.muOrder.Lock()
-	defer wd.muOrder.Unlock()
+	// The account channel is shared by all markets, only orders of this market are handled here.
+	orders := make([]*model.OrderData, 0, len(res.Orders))
 	for _, order := range res.Orders {
+		if order.MarketID == wd.marketId {
+			orders = append(orders, order)
+		}
+	}
+
+	// Forward updates to client side order trackers such as brackets.
+	for _, order := range orders {
+		wd.client.PublishOrderUpdate(order)
+	}
+
+	wd.muOrder.Lock()
+	for _, order := range orders {
 		wd.orders[order.OrderId] = order.Status
 	}
+	wd.muOrder.Unlock()
+
+	wd.strategy.OnAccount(wd.ctx, res)
+	for _, order := range orders {
+		wd.strategy.OnOrderUpdate(wd.ctx, order)
+	}
 }
@@ -0,0 +1,31 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWatchDogNotifyCoalesces(t *testing.T) {
+	wd := NewWatchDog(nil, nil, "BTC-USD", &DummyStrategy{}, RiskLimits{}, nil, make(chan struct{}))
+
+	// The listener is not running, Notify must not block.
+	for i := 0; i < 1000; i++ {
+		wd.Notify(StreamEvent{Type: STREAM_STALE, Channel: "orderbook:BTC-USD"})
+		wd.Notify(StreamEvent{Type: STREAM_DISCONNECTED})
+		wd.Notify(StreamEvent{Type: STREAM_FRESH, Channel: "orderbook:BTC-USD"})
+		wd.Notify(StreamEvent{Type: STREAM_GAP, Channel: "trade:BTC-USD"})
+		wd.Notify(StreamEvent{Type: STREAM_CONNECTED})
+	}
+
+	want := []StreamEvent{
+		{Type: STREAM_FRESH, Channel: "orderbook:BTC-USD"},
+		{Type: STREAM_CONNECTED},
+		{Type: STREAM_GAP, Channel: "trade:BTC-USD"},
+	}
+	if got := wd.takeEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+	if got := wd.takeEvents(); len(got) != 0 {
+		t.Errorf("events after take = %+v, want none", got)
+	}
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"rabbitx-client/model"
+	"sort"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// AccountManager owns several RbClients, one per wallet or profile, keyed by account name.
+// All clients share one HTTP transport, so connections to the exchange are reused,
+// while each keeps its own cookies and secrets.
+type AccountManager struct {
+	env          Environment
+	store        SecretStore
+	transport    http.RoundTripper
+	mu           sync.RWMutex
+	clients      map[string]*RbClient
+	profileIds   map[uint]string
+	allowMainnet bool
+}
+
+// NewAccountManager creates a new AccountManager for the environment loading credentials from store.
+func NewAccountManager(env Environment, store SecretStore) *AccountManager {
+	return &AccountManager{
+		env:        env,
+		store:      store,
+		transport:  http.DefaultTransport.(*http.Transport).Clone(),
+		clients:    make(map[string]*RbClient),
+		profileIds: make(map[uint]string),
+	}
+}
+
+// Add loads credentials of the named account and creates its client.
+// Adding an existing name returns the existing client.
+// Malformed credentials are reported as an error.
+func (m *AccountManager) Add(name string) (*RbClient, error) {
+	if c, ok := m.Client(name); ok {
+		return c, nil
+	}
+
+	// The store may be slow, e.g. a vault, so it is read without holding the lock.
+	creds, err := m.store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := creds.Validate(); err != nil {
+		return nil, fmt.Errorf("account %s: %w", name, err)
+	}
+
+	c := NewRbClientForEnvironment(m.env, creds)
+	c.SetTransport(m.transport)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another caller added the account while its credentials were loading.
+	if existing, ok := m.clients[name]; ok {
+		return existing, nil
+	}
+
+	c.AllowMainnet(m.allowMainnet)
+	m.clients[name] = c
+
+	return c, nil
+}
+
+// AllowMainnet enables or disables trading on mainnet for all current and future accounts.
+func (m *AccountManager) AllowMainnet(allow bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.allowMainnet = allow
+	for _, c := range m.clients {
+		c.AllowMainnet(allow)
+	}
+}
+
+// Remove drops the named account from the manager.
+func (m *AccountManager) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.clients, name)
+	for id, n := range m.profileIds {
+		if n == name {
+			delete(m.profileIds, id)
+		}
+	}
+}
+
+// Client returns the client of the named account.
+func (m *AccountManager) Client(name string) (*RbClient, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.clients[name]
+	return c, ok
+}
+
+// ClientByProfile returns the client of the account with the given profile ID.
+// Profile IDs become known after the first call of Profiles.
+func (m *AccountManager) ClientByProfile(profileId uint) (*RbClient, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name, ok := m.profileIds[profileId]
+	if !ok {
+		return nil, false
+	}
+
+	c, ok := m.clients[name]
+	return c, ok
+}
+
+// Names returns sorted names of all accounts.
+func (m *AccountManager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.clients))
+	for name := range m.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Profiles fetches profiles of all accounts concurrently, keyed by account name.
+// The first error is returned together with the profiles fetched successfully.
+func (m *AccountManager) Profiles() (map[string]*model.ProfileData, error) {
+	m.mu.RLock()
+	clients := make(map[string]*RbClient, len(m.clients))
+	for name, c := range m.clients {
+		clients[name] = c
+	}
+	m.mu.RUnlock()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		profiles = make(map[string]*model.ProfileData, len(clients))
+	)
+
+	for name, c := range clients {
+		wg.Add(1)
+		go func(name string, c *RbClient) {
+			defer wg.Done()
+
+			profile, err := c.GetProfile()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("account %s: %w", name, err)
+				}
+				return
+			}
+			profiles[name] = profile
+		}(name, c)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	for name, profile := range profiles {
+		m.profileIds[profile.ProfileID] = name
+	}
+	m.mu.Unlock()
+
+	return profiles, firstErr
+}
+
+// TotalEquity returns the sum of account equity over all accounts.
+func (m *AccountManager) TotalEquity() (decimal.Decimal, error) {
+	profiles, err := m.Profiles()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	total := decimal.Zero
+	for _, profile := range profiles {
+		if profile.AccountEquity != nil {
+			total = total.Add(*profile.AccountEquity)
+		}
+	}
+
+	return total, nil
+}
+
+// Positions returns open positions of all accounts, keyed by account name.
+func (m *AccountManager) Positions() (map[string][]*model.PositionData, error) {
+	profiles, err := m.Profiles()
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[string][]*model.PositionData, len(profiles))
+	for name, profile := range profiles {
+		positions[name] = profile.Positions
+	}
+
+	return positions, nil
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+// mapSecretStore is a SecretStore of fixed credentials.
+type mapSecretStore map[string]*Credentials
+
+// Load implements SecretStore.
+func (s mapSecretStore) Load(name string) (*Credentials, error) {
+	creds, ok := s[name]
+	if !ok {
+		return nil, errors.New("unknown account")
+	}
+
+	return creds, nil
+}
+
+func TestAccountManagerAdd(t *testing.T) {
+	store := mapSecretStore{
+		"maker":   {Wallet: "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", PrivateKey: "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"},
+		"api":     {Wallet: "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", APIKey: "key", APISecret: "0x01", RefreshToken: "token"},
+		"bad":     {Wallet: "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", PrivateKey: "0xnothex"},
+		"prefix":  {Wallet: "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", PrivateKey: "0x"},
+		"invalid": {Wallet: "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", PrivateKey: "00"},
+	}
+	m := NewAccountManager(Testnet, store)
+
+	for _, name := range []string{"maker", "api"} {
+		c, err := m.Add(name)
+		if err != nil {
+			t.Fatalf("Add(%s) error = %v", name, err)
+		}
+
+		again, err := m.Add(name)
+		if err != nil || again != c {
+			t.Errorf("Add(%s) again = %p, %v, want the existing client", name, again, err)
+		}
+	}
+
+	for _, name := range []string{"bad", "prefix", "invalid", "missing"} {
+		if _, err := m.Add(name); err == nil {
+			t.Errorf("Add(%s): expected error", name)
+		}
+		if _, ok := m.Client(name); ok {
+			t.Errorf("Add(%s) failed but the account was added", name)
+		}
+	}
+}
@@ -0,0 +1,615 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"rabbitx-client/model"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// DEFAULT_POLL_INTERVAL is the period of REST polling used as fallback for account@ updates.
+const DEFAULT_POLL_INTERVAL = 5 * time.Second
+
+// WHOLE_POSITION_SIZE_PERCENT is the default size percent of a stop loss or take profit
+// closing the whole position, brackets send the protected part of the position scaled by it.
+// The scale of size_percent, 0 to 1 or 0 to 100, is not confirmed against the exchange:
+// check it with a testnet order and set BracketRequest.WholePositionPercent to 100 if needed.
+const WHOLE_POSITION_SIZE_PERCENT = 1
+
+// Bracket states.
+const (
+	// BRACKET_PENDING means the entry order is waiting to be filled.
+	BRACKET_PENDING = "pending"
+
+	// BRACKET_ACTIVE means the entry is filled and stop loss and take profit are placed.
+	BRACKET_ACTIVE = "active"
+
+	// BRACKET_DONE means one protective order triggered and the other one was canceled.
+	BRACKET_DONE = "done"
+
+	// BRACKET_CANCELED means the entry was canceled before filling or the bracket was canceled.
+	BRACKET_CANCELED = "canceled"
+
+	// BRACKET_FAILED means protective orders could not be placed and the entry was rolled back.
+	BRACKET_FAILED = "failed"
+)
+
+// BracketRequest describes an entry order protected by stop loss and take profit.
+type BracketRequest struct {
+	Entry           *DecimalOrderCreateRequest // The entry order, limit or market.
+	StopLossPrice   decimal.Decimal            // The trigger price of the stop loss.
+	TakeProfitPrice decimal.Decimal            // The trigger price of the take profit.
+	PollInterval    time.Duration              // The period of REST polling, DEFAULT_POLL_INTERVAL if zero.
+
+	// WholePositionPercent is the size percent closing the whole position, WHOLE_POSITION_SIZE_PERCENT if zero.
+	WholePositionPercent decimal.Decimal
+}
+
+// Bracket tracks an entry order and its protective STOP_LOSS and TAKE_PROFIT orders.
+// Once the entry fills, stop loss and take profit are placed with SizePercent
+// of the resulting position equal to the filled size. They are position orders,
+// reported by the exchange as StopLoss and TakeProfit of ExtendedPositionData,
+// and Position returns the bracket in that form. When one of them closes,
+// the other is canceled. If a protective order can not be placed,
+// the placed one is canceled and the filled size is closed by a market order.
+//
+// Order updates are taken from PublishOrderUpdate, e.g. fed from account@ channel,
+// and REST polling every PollInterval.
+type Bracket struct {
+	client         *RbClient
+	req            BracketRequest
+	updates        chan *model.OrderData
+	cancelCh       chan chan error
+	done           chan struct{}
+	removeListener func()
+	mu             sync.RWMutex
+	state          string
+	entryId        string
+	stopLossId     string
+	takeProfitId   string
+	stopLoss       *model.OrderData
+	takeProfit     *model.OrderData
+	protected      decimal.Decimal
+	entryDone      bool
+	err            error
+}
+
+// PlaceBracket places the entry order and starts tracking the bracket.
+func (c *RbClient) PlaceBracket(req BracketRequest) (*Bracket, error) {
+	if err := checkBracketRequest(&req); err != nil {
+		return nil, err
+	}
+
+	b := &Bracket{
+		client:   c,
+		req:      req,
+		updates:  make(chan *model.OrderData, 1024),
+		cancelCh: make(chan chan error),
+		done:     make(chan struct{}),
+		state:    BRACKET_PENDING,
+	}
+
+	// Listen before placing, so an early fill is queued until the entry ID is known.
+	b.removeListener = c.AddOrderListener(b)
+
+	entry := *req.Entry
+	order, err := c.CreateOrderDecimal(&entry)
+	if err != nil {
+		b.removeListener()
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.entryId = order.OrderId
+	b.mu.Unlock()
+
+	logrus.Infof("Bracket entry order placed id : %s", order.OrderId)
+
+	go b.run()
+
+	return b, nil
+}
+
+// OnOrderUpdate implements OrderListener.
+func (b *Bracket) OnOrderUpdate(order *model.OrderData) {
+	select {
+	case b.updates <- order:
+	default:
+		// Updates are dropped when the queue is full, polling recovers the state.
+	}
+}
+
+// State returns the current bracket state.
+func (b *Bracket) State() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.state
+}
+
+// OrderIds returns IDs of the entry, stop loss and take profit orders, empty if not placed.
+func (b *Bracket) OrderIds() (entryId, stopLossId, takeProfitId string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.entryId, b.stopLossId, b.takeProfitId
+}
+
+// Done is closed when the bracket reaches a final state.
+func (b *Bracket) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err returns the error which failed the bracket, if any.
+func (b *Bracket) Err() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.err
+}
+
+// Position returns the position protected by the bracket with its stop loss and take profit,
+// as the exchange reports them in ExtendedPositionData. Orders are as last seen by the bracket.
+func (b *Bracket) Position() (*model.ExtendedPositionData, error) {
+	profile, err := b.client.GetProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	marketId := b.req.Entry.MarketId
+	for _, position := range profile.Positions {
+		if position.MarketID != marketId {
+			continue
+		}
+
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+
+		res := &model.ExtendedPositionData{PositionData: *position}
+		if b.stopLoss != nil {
+			stopLoss := *b.stopLoss
+			res.StopLoss = &stopLoss
+		}
+		if b.takeProfit != nil {
+			takeProfit := *b.takeProfit
+			res.TakeProfit = &takeProfit
+		}
+
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("no position in %s", marketId)
+}
+
+// Cancel cancels the pending entry or the placed protective orders.
+// A filled position is left open. If a pending entry filled partly, stop loss and
+// take profit are placed for the filled size before the entry is canceled and the
+// bracket stays active; cancel it again to remove the protection.
+func (b *Bracket) Cancel() error {
+	res := make(chan error, 1)
+
+	select {
+	case b.cancelCh <- res:
+		return <-res
+	case <-b.done:
+		return nil
+	}
+}
+
+// run processes order updates and polls until the bracket is finished.
+func (b *Bracket) run() {
+	defer close(b.done)
+	defer b.removeListener()
+
+	interval := b.req.PollInterval
+	if interval <= 0 {
+		interval = DEFAULT_POLL_INTERVAL
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for !b.isFinished() {
+		select {
+		case order := <-b.updates:
+			b.handleOrder(order)
+		case <-ticker.C:
+			b.poll()
+		case res := <-b.cancelCh:
+			res <- b.cancel()
+		}
+	}
+}
+
+// poll refreshes tracked orders over REST.
+func (b *Bracket) poll() {
+	entryId, stopLossId, takeProfitId := b.OrderIds()
+
+	var ids []string
+	switch b.State() {
+	case BRACKET_PENDING:
+		ids = []string{entryId}
+	case BRACKET_ACTIVE:
+		ids = []string{stopLossId, takeProfitId}
+		if !b.isEntryDone() {
+			ids = append(ids, entryId)
+		}
+	}
+
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+
+		order, err := b.client.GetOrder(b.req.Entry.MarketId, id)
+		if err != nil {
+			logrus.Warnf("Bracket failed to poll order %s: %s", id, err)
+			continue
+		}
+		b.handleOrder(order)
+	}
+}
+
+// handleOrder applies an order update to the bracket.
+func (b *Bracket) handleOrder(order *model.OrderData) {
+	entryId, stopLossId, takeProfitId := b.OrderIds()
+
+	switch b.State() {
+	case BRACKET_PENDING:
+		if order.OrderId != entryId {
+			return
+		}
+
+		switch order.Status {
+		case model.CLOSED:
+			b.setEntryDone()
+			b.protect(order)
+		case model.CANCELED, model.REJECTED:
+			b.setEntryDone()
+			if filledSize(order).IsPositive() {
+				b.protect(order)
+				return
+			}
+			b.finish(BRACKET_CANCELED, nil)
+		}
+	case BRACKET_ACTIVE:
+		var other *string
+		switch order.OrderId {
+		case entryId:
+			// The entry filled further after it was protected, e.g. while it was canceled.
+			if isFinal(order.Status) {
+				b.setEntryDone()
+			}
+			b.protect(order)
+			return
+		case stopLossId:
+			other = &takeProfitId
+		case takeProfitId:
+			other = &stopLossId
+		default:
+			return
+		}
+
+		b.trackLeg(order)
+
+		switch order.Status {
+		case model.CLOSED:
+			logrus.Infof("Bracket order %s closed, canceling %s", order.OrderId, *other)
+			b.cancelOrder(*other)
+			b.finish(BRACKET_DONE, nil)
+		case model.CANCELED, model.REJECTED:
+			// Canceled outside of the bracket, keep tracking the remaining leg.
+			b.mu.Lock()
+			if order.OrderId == b.stopLossId {
+				b.stopLossId = ""
+			} else {
+				b.takeProfitId = ""
+			}
+			bothGone := b.stopLossId == "" && b.takeProfitId == ""
+			b.mu.Unlock()
+
+			if bothGone {
+				b.finish(BRACKET_CANCELED, nil)
+			}
+		}
+	}
+}
+
+// protect places stop loss and take profit for the filled size of the entry.
+// Protective orders placed for a smaller fill are replaced, the new ones cover it as well.
+func (b *Bracket) protect(entry *model.OrderData) {
+	marketId := b.req.Entry.MarketId
+	filled := filledSize(entry)
+
+	b.mu.RLock()
+	protected := b.protected
+	oldStopLossId, oldTakeProfitId := b.stopLossId, b.takeProfitId
+	b.mu.RUnlock()
+
+	if !filled.GreaterThan(protected) {
+		return
+	}
+
+	sizePercent, err := b.positionPercent(marketId, filled)
+	if err != nil {
+		logrus.Warnf("Bracket failed to get position, protecting the whole position: %s", err)
+		sizePercent = b.wholePercent()
+	}
+
+	stopLoss, err := b.placeProtective(StopLoss(marketId, b.req.StopLossPrice, sizePercent))
+	if err != nil {
+		b.protectFailed(filled, protected, "", err)
+		return
+	}
+
+	takeProfit, err := b.placeProtective(TakeProfit(marketId, b.req.TakeProfitPrice, sizePercent))
+	if err != nil {
+		b.protectFailed(filled, protected, stopLoss.OrderId, err)
+		return
+	}
+
+	b.mu.Lock()
+	b.state = BRACKET_ACTIVE
+	b.stopLossId, b.takeProfitId = stopLoss.OrderId, takeProfit.OrderId
+	b.stopLoss, b.takeProfit = stopLoss, takeProfit
+	b.protected = filled
+	b.mu.Unlock()
+
+	logrus.Infof("Bracket active for size %s, stop loss id : %s, take profit id : %s", filled, stopLoss.OrderId, takeProfit.OrderId)
+
+	b.cancelOrder(oldStopLossId)
+	b.cancelOrder(oldTakeProfitId)
+}
+
+// protectFailed handles a failed placement of protective orders. The first protection
+// is rolled back, a failed extension keeps the orders protecting the smaller fill.
+func (b *Bracket) protectFailed(filled, protected decimal.Decimal, placedId string, cause error) {
+	if !protected.IsPositive() {
+		b.rollback(filled, placedId, cause)
+		return
+	}
+
+	logrus.Errorf("Bracket failed to extend protection from %s to %s: %s", protected, filled, cause)
+	b.cancelOrder(placedId)
+}
+
+// trackLeg keeps the last seen state of a protective order.
+func (b *Bracket) trackLeg(order *model.OrderData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	leg := *order
+	if order.OrderId == b.stopLossId {
+		b.stopLoss = &leg
+	} else if order.OrderId == b.takeProfitId {
+		b.takeProfit = &leg
+	}
+}
+
+// positionPercent returns the part of the current position made by the filled size.
+func (b *Bracket) positionPercent(marketId string, filled decimal.Decimal) (decimal.Decimal, error) {
+	one := decimal.NewFromInt(1)
+	whole := b.wholePercent()
+
+	profile, err := b.client.GetProfile()
+	if err != nil {
+		return whole, err
+	}
+
+	for _, position := range profile.Positions {
+		if position.MarketID != marketId || !position.Size.Abs().IsPositive() {
+			continue
+		}
+
+		percent := filled.Div(position.Size.Abs())
+		if percent.GreaterThan(one) || !filled.IsPositive() {
+			return whole, nil
+		}
+		return percent.Mul(whole), nil
+	}
+
+	return whole, fmt.Errorf("no position in %s", marketId)
+}
+
+// wholePercent returns the size percent closing the whole position.
+func (b *Bracket) wholePercent() decimal.Decimal {
+	if b.req.WholePositionPercent.IsPositive() {
+		return b.req.WholePositionPercent
+	}
+
+	return decimal.NewFromInt(WHOLE_POSITION_SIZE_PERCENT)
+}
+
+// placeProtective builds and places a protective order.
+func (b *Bracket) placeProtective(builder *OrderBuilder) (*model.OrderData, error) {
+	req, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := b.client.CreateOrderDecimal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return order.OrderData(), nil
+}
+
+// rollback cancels the placed protective order and closes the filled size.
+func (b *Bracket) rollback(filled decimal.Decimal, placedId string, cause error) {
+	logrus.Errorf("Bracket failed to place protective orders, rolling back: %s", cause)
+
+	b.cancelOrder(placedId)
+
+	errs := []error{cause}
+	if filled.IsPositive() {
+		side := model.SHORT
+		if b.req.Entry.Side == model.SHORT {
+			side = model.LONG
+		}
+
+		req, err := Market(b.req.Entry.MarketId, side, filled).Build()
+		if err == nil {
+			_, err = b.client.CreateOrderDecimal(req)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to close filled entry: %w", err))
+		}
+	}
+
+	b.finish(BRACKET_FAILED, errors.Join(errs...))
+}
+
+// cancel cancels whatever the bracket has resting on the exchange.
+func (b *Bracket) cancel() error {
+	entryId, stopLossId, takeProfitId := b.OrderIds()
+
+	var errs []error
+	switch b.State() {
+	case BRACKET_PENDING:
+		// Protect what filled so far before the entry is gone.
+		b.protectFilled(entryId)
+		if b.isFinished() {
+			return b.Err()
+		}
+
+		err := b.cancelOrder(entryId)
+
+		// Fills between the check and the cancel.
+		b.protectFilled(entryId)
+		if b.State() == BRACKET_ACTIVE {
+			return err
+		}
+		errs = append(errs, err)
+	case BRACKET_ACTIVE:
+		errs = append(errs, b.cancelOrder(stopLossId), b.cancelOrder(takeProfitId))
+	}
+
+	err := errors.Join(errs...)
+	b.finish(BRACKET_CANCELED, err)
+
+	return err
+}
+
+// protectFilled protects the filled size of the entry loaded over REST.
+func (b *Bracket) protectFilled(entryId string) {
+	entry, err := b.client.GetOrder(b.req.Entry.MarketId, entryId)
+	if err != nil {
+		logrus.Warnf("Bracket failed to load entry order %s: %s", entryId, err)
+		return
+	}
+
+	if isFinal(entry.Status) {
+		b.setEntryDone()
+	}
+
+	if filledSize(entry).IsPositive() {
+		b.protect(entry)
+	}
+}
+
+// setEntryDone records that the entry can not fill any more.
+func (b *Bracket) setEntryDone() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entryDone = true
+}
+
+// isEntryDone reports whether the entry can not fill any more.
+func (b *Bracket) isEntryDone() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.entryDone
+}
+
+// cancelOrder cancels an order if the ID is set.
+func (b *Bracket) cancelOrder(orderId string) error {
+	if orderId == "" {
+		return nil
+	}
+
+	_, err := b.client.CancelOrder(&OrderCancelRequest{
+		OrderId:  orderId,
+		MarketId: b.req.Entry.MarketId,
+	})
+	if err != nil {
+		logrus.Errorf("Bracket failed to cancel order %s: %s", orderId, err)
+	}
+
+	return err
+}
+
+// finish moves the bracket to a final state.
+func (b *Bracket) finish(state string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = state
+	b.err = err
+}
+
+// isFinished reports whether the bracket reached a final state.
+func (b *Bracket) isFinished() bool {
+	state := b.State()
+	return state != BRACKET_PENDING && state != BRACKET_ACTIVE
+}
+
+// checkBracketRequest checks that the entry and protective prices are consistent.
+func checkBracketRequest(req *BracketRequest) error {
+	if req.Entry == nil {
+		return errors.New("bracket entry order is required")
+	}
+
+	if req.Entry.Type != model.LIMIT && req.Entry.Type != model.MARKET {
+		return fmt.Errorf("bracket entry must be limit or market order, got %s", req.Entry.Type)
+	}
+
+	if !req.StopLossPrice.IsPositive() || !req.TakeProfitPrice.IsPositive() {
+		return errors.New("bracket stop loss and take profit prices must be positive")
+	}
+
+	switch req.Entry.Side {
+	case model.LONG:
+		if !req.StopLossPrice.LessThan(req.TakeProfitPrice) {
+			return errors.New("long bracket stop loss must be below take profit")
+		}
+	case model.SHORT:
+		if !req.StopLossPrice.GreaterThan(req.TakeProfitPrice) {
+			return errors.New("short bracket stop loss must be above take profit")
+		}
+	default:
+		return fmt.Errorf("unknown bracket side %q", req.Entry.Side)
+	}
+
+	return nil
+}
+
+// isFinal reports whether an order with the status can not change any more.
+func isFinal(status string) bool {
+	return status == model.CLOSED || status == model.CANCELED || status == model.REJECTED
+}
+
+// filledSize returns the filled size of an order.
+// Closed orders without fill information are considered fully filled.
+func filledSize(order *model.OrderData) decimal.Decimal {
+	if order.TotalFilledSize != nil {
+		return *order.TotalFilledSize
+	}
+
+	if order.Status == model.CLOSED {
+		if order.InitialSize != nil {
+			return *order.InitialSize
+		}
+		if order.Size != nil {
+			return *order.Size
+		}
+	}
+
+	return decimal.Zero
+}
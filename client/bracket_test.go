@@ -0,0 +1,153 @@
+package client
+
+import (
+	"encoding/json"
+	"rabbitx-client/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// placeTestBracket places a long bracket of size 0.002 on the fake exchange.
+func placeTestBracket(t *testing.T, c *RbClient) *Bracket {
+	return placeTestBracketWithPercent(t, c, decimal.Zero)
+}
+
+// placeTestBracketWithPercent places the test bracket with the size percent of the whole position.
+func placeTestBracketWithPercent(t *testing.T, c *RbClient, wholePercent decimal.Decimal) *Bracket {
+	t.Helper()
+
+	entry, err := Limit("BTC-USD", model.LONG, decimal.RequireFromString("27000"), decimal.RequireFromString("0.002")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := c.PlaceBracket(BracketRequest{
+		Entry:           entry,
+		StopLossPrice:   decimal.RequireFromString("26000"),
+		TakeProfitPrice: decimal.RequireFromString("28000"),
+		PollInterval:    time.Hour,
+
+		WholePositionPercent: wholePercent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestBracketCancelProtectsPartialFill(t *testing.T) {
+	c, ex := newTestExchangeClient(t)
+	b := placeTestBracket(t, c)
+	entryId, _, _ := b.OrderIds()
+
+	ex.fill(entryId, decimal.RequireFromString("0.001"))
+
+	if err := b.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"create limit", "create stop_loss", "create take_profit", "cancel limit"}
+	if got := ex.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+
+	if state := b.State(); state != BRACKET_ACTIVE {
+		t.Fatalf("state = %s, want %s", state, BRACKET_ACTIVE)
+	}
+
+	_, stopLossId, takeProfitId := b.OrderIds()
+	if percent := ex.order(stopLossId).SizePercent; percent == nil || !percent.Equal(decimal.NewFromInt(WHOLE_POSITION_SIZE_PERCENT)) {
+		t.Errorf("stop loss size percent = %v, want the whole position", percent)
+	}
+
+	position, err := b.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position.StopLoss == nil || position.StopLoss.OrderId != stopLossId {
+		t.Errorf("position stop loss = %+v, want order %s", position.StopLoss, stopLossId)
+	}
+	if position.TakeProfit == nil || position.TakeProfit.OrderId != takeProfitId {
+		t.Errorf("position take profit = %+v, want order %s", position.TakeProfit, takeProfitId)
+	}
+
+	// The second cancel removes the protection.
+	if err := b.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	<-b.Done()
+	if state := b.State(); state != BRACKET_CANCELED {
+		t.Errorf("state = %s, want %s", state, BRACKET_CANCELED)
+	}
+}
+
+func TestBracketCancelUnfilled(t *testing.T) {
+	c, ex := newTestExchangeClient(t)
+	b := placeTestBracket(t, c)
+
+	if err := b.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	<-b.Done()
+
+	want := []string{"create limit", "cancel limit"}
+	if got := ex.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+	if state := b.State(); state != BRACKET_CANCELED {
+		t.Errorf("state = %s, want %s", state, BRACKET_CANCELED)
+	}
+}
+
+func TestBracketWholePositionPercent(t *testing.T) {
+	c, ex := newTestExchangeClient(t)
+	b := placeTestBracketWithPercent(t, c, decimal.NewFromInt(100))
+	entryId, _, _ := b.OrderIds()
+
+	ex.fill(entryId, decimal.RequireFromString("0.001"))
+	if err := b.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stopLossId, takeProfitId := b.OrderIds()
+	for _, id := range []string{stopLossId, takeProfitId} {
+		if percent := ex.order(id).SizePercent; percent == nil || !percent.Equal(decimal.NewFromInt(100)) {
+			t.Errorf("size percent of order %s = %v, want 100", id, percent)
+		}
+	}
+}
+
+// The scale of size_percent is not confirmed against the exchange, the test pins what is sent.
+func TestProtectiveSizePercentSerialized(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent decimal.Decimal
+		want    string
+	}{
+		{"whole position", decimal.NewFromInt(WHOLE_POSITION_SIZE_PERCENT), `"size_percent":1,`},
+		{"half position", decimal.RequireFromString("0.5"), `"size_percent":0.5,`},
+		{"whole position on a 0-100 scale", decimal.NewFromInt(100), `"size_percent":100,`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := StopLoss("BTC-USD", decimal.RequireFromString("26000"), tt.percent).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"fmt"
+	"rabbitx-client/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// OrderBuilder builds validated DecimalOrderCreateRequest values.
+// Start with one of the order kind constructors, chain options and call Build:
+//
+//	req, err := client.Limit("ETH-USD", model.LONG, price, size).PostOnly().ClientID("q-1").Build()
+//
+// Each constructor takes exactly the fields its order type requires,
+// options which make no sense for the order type are reported by Build.
+type OrderBuilder struct {
+	req DecimalOrderCreateRequest
+	err error
+}
+
+// Limit starts a limit order.
+func Limit(marketId, side string, price, size decimal.Decimal) *OrderBuilder {
+	return newOrderBuilder(marketId, model.LIMIT, side).price(price).size(size)
+}
+
+// Market starts a market order.
+func Market(marketId, side string, size decimal.Decimal) *OrderBuilder {
+	return newOrderBuilder(marketId, model.MARKET, side).size(size)
+}
+
+// StopLimit starts a limit order placed when the market reaches triggerPrice.
+func StopLimit(marketId, side string, triggerPrice, price, size decimal.Decimal) *OrderBuilder {
+	return newOrderBuilder(marketId, model.STOP_LIMIT, side).trigger(triggerPrice).price(price).size(size)
+}
+
+// StopMarket starts a market order placed when the market reaches triggerPrice.
+func StopMarket(marketId, side string, triggerPrice, size decimal.Decimal) *OrderBuilder {
+	return newOrderBuilder(marketId, model.STOP_MARKET, side).trigger(triggerPrice).size(size)
+}
+
+// StopLoss starts a stop loss order closing sizePercent of the position at triggerPrice.
+func StopLoss(marketId string, triggerPrice, sizePercent decimal.Decimal) *OrderBuilder {
+	return newOrderBuilder(marketId, model.STOP_LOSS, "").trigger(triggerPrice).sizePercent(sizePercent)
+}
+
+// TakeProfit starts a take profit order closing sizePercent of the position at triggerPrice.
+func TakeProfit(marketId string, triggerPrice, sizePercent decimal.Decimal) *OrderBuilder {
+	return newOrderBuilder(marketId, model.TAKE_PROFIT, "").trigger(triggerPrice).sizePercent(sizePercent)
+}
+
+// PostOnly makes a limit order cancel instead of taking liquidity.
+func (b *OrderBuilder) PostOnly() *OrderBuilder {
+	return b.timeInForce(model.POST_ONLY, model.LIMIT, model.STOP_LIMIT)
+}
+
+// IOC makes the order cancel the part which is not filled immediately.
+func (b *OrderBuilder) IOC() *OrderBuilder {
+	return b.timeInForce(model.IMMEDIATE_OR_CANCEL, model.LIMIT, model.MARKET, model.STOP_LIMIT, model.STOP_MARKET)
+}
+
+// FOK makes the order either fill completely or cancel.
+func (b *OrderBuilder) FOK() *OrderBuilder {
+	return b.timeInForce(model.FILL_OR_KILL, model.LIMIT, model.MARKET, model.STOP_LIMIT, model.STOP_MARKET)
+}
+
+// GTC makes the order rest until canceled.
+func (b *OrderBuilder) GTC() *OrderBuilder {
+	return b.timeInForce(model.GOOD_TILL_CANCEL, model.LIMIT, model.STOP_LIMIT)
+}
+
+// ClientID sets the client order ID.
+func (b *OrderBuilder) ClientID(clientOrderId string) *OrderBuilder {
+	if clientOrderId == "" {
+		b.fail(fmt.Errorf("empty client order ID"))
+		return b
+	}
+
+	b.req.ClientOrderId = &clientOrderId
+	return b
+}
+
+// Build returns the request or the first error found while building and validating it.
+func (b *OrderBuilder) Build() (*DecimalOrderCreateRequest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	req := b.req
+	if err := Validate(&req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// newOrderBuilder starts a builder for the order type.
+func newOrderBuilder(marketId, orderType, side string) *OrderBuilder {
+	return &OrderBuilder{
+		req: DecimalOrderCreateRequest{
+			MarketId: marketId,
+			Type:     orderType,
+			Side:     side,
+		},
+	}
+}
+
+// price sets the order price, which must be positive.
+func (b *OrderBuilder) price(value decimal.Decimal) *OrderBuilder {
+	if !value.IsPositive() {
+		b.fail(fmt.Errorf("price must be positive, got %s", value))
+	}
+
+	b.req.Price = &value
+	return b
+}
+
+// size sets the order size, which must be positive.
+func (b *OrderBuilder) size(value decimal.Decimal) *OrderBuilder {
+	if !value.IsPositive() {
+		b.fail(fmt.Errorf("size must be positive, got %s", value))
+	}
+
+	b.req.Size = &value
+	return b
+}
+
+// trigger sets the order trigger price, which must be positive.
+func (b *OrderBuilder) trigger(value decimal.Decimal) *OrderBuilder {
+	if !value.IsPositive() {
+		b.fail(fmt.Errorf("trigger price must be positive, got %s", value))
+	}
+
+	b.req.TriggerPrice = &value
+	return b
+}
+
+// sizePercent sets the part of position the order closes, which must be positive.
+func (b *OrderBuilder) sizePercent(value decimal.Decimal) *OrderBuilder {
+	if !value.IsPositive() {
+		b.fail(fmt.Errorf("size percent must be positive, got %s", value))
+	}
+
+	b.req.SizePercent = &value
+	return b
+}
+
+// timeInForce sets time in force if the order type is one of allowed.
+func (b *OrderBuilder) timeInForce(value string, allowed ...string) *OrderBuilder {
+	for _, orderType := range allowed {
+		if b.req.Type == orderType {
+			b.req.TimeInForce = &value
+			return b
+		}
+	}
+
+	b.fail(fmt.Errorf("%s is not supported by %s orders", value, b.req.Type))
+	return b
+}
+
+// fail records the first error.
+func (b *OrderBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"rabbitx-client/model"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// optionalString formats an optional string, "<nil>" if it is not set.
+func optionalString(value *string) string {
+	if value == nil {
+		return "<nil>"
+	}
+
+	return *value
+}
+
+// optionalDecimal formats an optional decimal, "<nil>" if it is not set.
+func optionalDecimal(value *decimal.Decimal) string {
+	if value == nil {
+		return "<nil>"
+	}
+
+	return value.String()
+}
+
+func TestOrderBuilders(t *testing.T) {
+	price := decimal.RequireFromString("27000")
+	trigger := decimal.RequireFromString("26000")
+	size := decimal.RequireFromString("0.001")
+	percent := decimal.RequireFromString("1")
+
+	tests := []struct {
+		name         string
+		builder      *OrderBuilder
+		orderType    string
+		side         string
+		price        string
+		size         string
+		triggerPrice string
+		sizePercent  string
+		timeInForce  string
+		clientId     string
+	}{
+		{"limit", Limit("BTC-USD", model.LONG, price, size),
+			model.LIMIT, model.LONG, "27000", "0.001", "<nil>", "<nil>", "<nil>", "<nil>"},
+		{"limit post only", Limit("BTC-USD", model.LONG, price, size).PostOnly().ClientID("q-1"),
+			model.LIMIT, model.LONG, "27000", "0.001", "<nil>", "<nil>", model.POST_ONLY, "q-1"},
+		{"limit gtc", Limit("BTC-USD", model.SHORT, price, size).GTC(),
+			model.LIMIT, model.SHORT, "27000", "0.001", "<nil>", "<nil>", model.GOOD_TILL_CANCEL, "<nil>"},
+		{"market", Market("BTC-USD", model.SHORT, size),
+			model.MARKET, model.SHORT, "<nil>", "0.001", "<nil>", "<nil>", "<nil>", "<nil>"},
+		{"market ioc", Market("BTC-USD", model.SHORT, size).IOC(),
+			model.MARKET, model.SHORT, "<nil>", "0.001", "<nil>", "<nil>", model.IMMEDIATE_OR_CANCEL, "<nil>"},
+		{"market fok", Market("BTC-USD", model.LONG, size).FOK(),
+			model.MARKET, model.LONG, "<nil>", "0.001", "<nil>", "<nil>", model.FILL_OR_KILL, "<nil>"},
+		{"stop limit", StopLimit("BTC-USD", model.SHORT, trigger, price, size).PostOnly(),
+			model.STOP_LIMIT, model.SHORT, "27000", "0.001", "26000", "<nil>", model.POST_ONLY, "<nil>"},
+		{"stop market", StopMarket("BTC-USD", model.SHORT, trigger, size).IOC(),
+			model.STOP_MARKET, model.SHORT, "<nil>", "0.001", "26000", "<nil>", model.IMMEDIATE_OR_CANCEL, "<nil>"},
+		{"stop loss", StopLoss("BTC-USD", trigger, percent),
+			model.STOP_LOSS, "", "<nil>", "<nil>", "26000", "1", "<nil>", "<nil>"},
+		{"take profit", TakeProfit("BTC-USD", price, percent).ClientID("tp-1"),
+			model.TAKE_PROFIT, "", "<nil>", "<nil>", "27000", "1", "<nil>", "tp-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if req.MarketId != "BTC-USD" || req.Type != tt.orderType || req.Side != tt.side {
+				t.Errorf("order = %s %s %s, want BTC-USD %s %s", req.MarketId, req.Type, req.Side, tt.orderType, tt.side)
+			}
+			fields := []struct{ name, got, want string }{
+				{"price", optionalDecimal(req.Price), tt.price},
+				{"size", optionalDecimal(req.Size), tt.size},
+				{"trigger price", optionalDecimal(req.TriggerPrice), tt.triggerPrice},
+				{"size percent", optionalDecimal(req.SizePercent), tt.sizePercent},
+				{"time in force", optionalString(req.TimeInForce), tt.timeInForce},
+				{"client order ID", optionalString(req.ClientOrderId), tt.clientId},
+			}
+			for _, field := range fields {
+				if field.got != field.want {
+					t.Errorf("%s = %s, want %s", field.name, field.got, field.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderBuilderErrors(t *testing.T) {
+	price := decimal.RequireFromString("27000")
+	size := decimal.RequireFromString("0.001")
+
+	tests := []struct {
+		name    string
+		builder *OrderBuilder
+	}{
+		{"zero price", Limit("BTC-USD", model.LONG, decimal.Zero, size)},
+		{"negative size", Market("BTC-USD", model.LONG, size.Neg())},
+		{"zero trigger", StopMarket("BTC-USD", model.LONG, decimal.Zero, size)},
+		{"zero size percent", StopLoss("BTC-USD", price, decimal.Zero)},
+		{"post only market", Market("BTC-USD", model.LONG, size).PostOnly()},
+		{"gtc market", Market("BTC-USD", model.LONG, size).GTC()},
+		{"ioc stop loss", StopLoss("BTC-USD", price, decimal.NewFromInt(1)).IOC()},
+		{"fok take profit", TakeProfit("BTC-USD", price, decimal.NewFromInt(1)).FOK()},
+		{"empty client ID", Limit("BTC-USD", model.LONG, price, size).ClientID("")},
+		{"invalid side", Limit("BTC-USD", "up", price, size)},
+		{"missing market", Limit("", model.LONG, price, size)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if req, err := tt.builder.Build(); err == nil {
+				t.Errorf("Build() = %+v, want error", req)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ package client
 import (
 	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/cookiejar"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -21,14 +23,23 @@ import (
 // If a private key is set up, it performs onboarding.
 // If only an apiSecret is set up, it starts trading.
 type RbClient struct {
-	wallet       string
-	apiUrl       string
-	httpClient   http.Client
-	privateKey   *ecdsa.PrivateKey
-	refreshToken string
-	jwtPrivate   string
-	apiSecret    *model.APISecret
-	mu           sync.Mutex
+	wallet         string
+	apiUrl         string
+	httpClient     http.Client
+	privateKey     *ecdsa.PrivateKey
+	refreshToken   string
+	jwtPrivate     string
+	apiSecret      *model.APISecret
+	mu             sync.Mutex
+	muClock        sync.RWMutex
+	clock          Clock
+	clockOffset    time.Duration
+	clockBounds    *clockBounds
+	markets        *MarketRegistry
+	env            Environment
+	allowMainnet   bool
+	orderListeners orderListeners
+	clientOrders   *ClientOrderRegistry
 }
 
 // NewRbClient creates a new RbClient instance.
@@ -45,18 +56,17 @@ func NewRbClient(apiUrl, wallet, privateKey, apiKey, apiSecret, refreshToken, jw
 		httpClient:   http.Client{Jar: jar},
 		refreshToken: refreshToken,
 		jwtPrivate:   jwtPrivate,
+		clock:        systemClock{},
+		env: Environment{
+			Name:    ENV_CUSTOM,
+			ApiUrl:  apiUrl,
+			Mainnet: isMainnetUrl(apiUrl),
+		},
 	}
+	rc.markets = NewMarketRegistry(rc, DEFAULT_MARKETS_TTL)
 
 	if privateKey != "" {
-		if strings.HasPrefix(privateKey, "0x") {
-			privateKey = privateKey[2:]
-		}
-
-		if len(privateKey) == 0 {
-			panic("Invalid private key")
-		}
-
-		pk, err := crypto.HexToECDSA(privateKey)
+		pk, err := parsePrivateKey(privateKey)
 		if err != nil {
 			panic(err)
 		}
@@ -76,15 +86,36 @@ func NewRbClient(apiUrl, wallet, privateKey, apiKey, apiSecret, refreshToken, jw
 	return rc
 }
 
+// parsePrivateKey parses a hex encoded private key with or without 0x prefix.
+func parsePrivateKey(privateKey string) (*ecdsa.PrivateKey, error) {
+	privateKey = strings.TrimPrefix(privateKey, "0x")
+	if len(privateKey) == 0 {
+		return nil, errors.New("invalid private key")
+	}
+
+	return crypto.HexToECDSA(privateKey)
+}
+
+// SetTransport replaces the HTTP transport of the client, e.g. to share connections between clients.
+func (c *RbClient) SetTransport(transport http.RoundTripper) {
+	c.httpClient.Transport = transport
+}
+
+// Markets returns the market registry used to normalise decimal orders.
+func (c *RbClient) Markets() *MarketRegistry {
+	return c.markets
+}
+
 // GetSecrets retrieves the API secret key and secret.
 // If the API secret is expired or nil, it will be updated automatically.
 func (c *RbClient) GetSecrets() (apiKey string, apiSecret string, jwtPrivate string, err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if !isApiSecretExpired(c.apiSecret) {
+	now := c.now()
+	if !isApiSecretExpired(c.apiSecret, now) {
 		// Check if close to expired update it
-		if isCloseToExpired(c.apiSecret) {
+		if isCloseToExpired(c.apiSecret, now) {
 			secret, e := c.RefreshSecrets(c.apiSecret.Key, c.apiSecret.Secret, c.refreshToken)
 			if e == nil {
 				c.updateSecrets(secret.APISecret, secret.JwtPrivate, secret.RefreshToken)
@@ -97,6 +128,10 @@ func (c *RbClient) GetSecrets() (apiKey string, apiSecret string, jwtPrivate str
 	}
 
 	// Key expired we can update only by onboarding
+	if c.privateKey == nil {
+		return "", "", "", ErrNoCredentials
+	}
+
 	res, e := c.Onboarding(c.wallet, c.privateKey)
 	if e == nil {
 		c.updateSecrets(res.APISecret, res.Jwt, c.refreshToken)
@@ -0,0 +1,432 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"rabbitx-client/model"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDuplicateClientOrderId is returned when an order is created with a client order ID already in use.
+var ErrDuplicateClientOrderId = errors.New("duplicate client order ID")
+
+const (
+	// DEFAULT_CLIENT_ORDER_MAX_AGE is the age after which a client order ID is forgotten.
+	DEFAULT_CLIENT_ORDER_MAX_AGE = 7 * 24 * time.Hour
+
+	// DEFAULT_CLIENT_ORDER_FINAL_TTL is the time a closed, canceled or rejected order is kept.
+	DEFAULT_CLIENT_ORDER_FINAL_TTL = time.Hour
+
+	// DEFAULT_CLIENT_ORDER_MAX_ENTRIES is the maximum number of client order IDs kept.
+	DEFAULT_CLIENT_ORDER_MAX_ENTRIES = 10000
+
+	// DEFAULT_CLIENT_ORDER_FLUSH_INTERVAL is the delay batching registry writes to the file.
+	DEFAULT_CLIENT_ORDER_FLUSH_INTERVAL = time.Second
+)
+
+// ClientOrderIdGenerator produces unique client order IDs of the form
+// <tag>-<session>-<sequence>. The tag names the strategy, the session nonce
+// is random per generator, so IDs never repeat across restarts,
+// and the sequence grows monotonically within the session.
+type ClientOrderIdGenerator struct {
+	tag     string
+	session string
+	seq     atomic.Uint64
+}
+
+// NewClientOrderIdGenerator creates a new generator for the strategy tag.
+func NewClientOrderIdGenerator(tag string) (*ClientOrderIdGenerator, error) {
+	nonce := make([]byte, 4)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return &ClientOrderIdGenerator{
+		tag:     tag,
+		session: hex.EncodeToString(nonce),
+	}, nil
+}
+
+// Next returns the next client order ID.
+func (g *ClientOrderIdGenerator) Next() string {
+	return g.tag + "-" + g.session + "-" + strconv.FormatUint(g.seq.Add(1), 10)
+}
+
+// Tag returns the strategy tag of the generated IDs.
+func (g *ClientOrderIdGenerator) Tag() string {
+	return g.tag
+}
+
+// HasClientOrderTag reports whether the client order ID was generated for the strategy tag.
+func HasClientOrderTag(clientOrderId, tag string) bool {
+	return strings.HasPrefix(clientOrderId, tag+"-")
+}
+
+// ClientOrderEntry links a client order ID to the exchange order.
+type ClientOrderEntry struct {
+	ClientOrderId string `json:"client_order_id"`  // The client order ID.
+	OrderId       string `json:"order_id"`         // The exchange order ID.
+	MarketId      string `json:"market_id"`        // The market ID of the order.
+	Status        string `json:"status,omitempty"` // The last seen status of the order, empty if unknown.
+	UpdatedAt     int64  `json:"updated_at"`       // The time the entry was last updated, in milliseconds.
+}
+
+// ClientOrderRegistryConfig configures retention and persistence of a ClientOrderRegistry.
+type ClientOrderRegistryConfig struct {
+	MaxAge        time.Duration // The age after which any entry is evicted, DEFAULT_CLIENT_ORDER_MAX_AGE if zero.
+	FinalTTL      time.Duration // The time a final order is kept, DEFAULT_CLIENT_ORDER_FINAL_TTL if zero.
+	MaxEntries    int           // The maximum number of entries, DEFAULT_CLIENT_ORDER_MAX_ENTRIES if zero.
+	FlushInterval time.Duration // The delay batching writes, DEFAULT_CLIENT_ORDER_FLUSH_INTERVAL if zero.
+}
+
+// ClientOrderRegistry maps client order IDs to exchange order IDs and persists
+// the mapping to a JSON file, so orders can be correlated after restart.
+// Set it on a client with SetClientOrderRegistry.
+//
+// Orders seen closed, canceled or rejected are evicted after FinalTTL, any
+// entry after MaxAge, and the oldest entries beyond MaxEntries. Changes are
+// written to the file at most once per FlushInterval; call Close on shutdown
+// to write the pending ones.
+type ClientOrderRegistry struct {
+	path       string
+	config     ClientOrderRegistryConfig
+	now        func() time.Time
+	mu         sync.RWMutex
+	saveMu     sync.Mutex
+	byClient   map[string]ClientOrderEntry
+	byOrder    map[string]string
+	dirty      bool
+	flushTimer *time.Timer
+}
+
+// NewClientOrderRegistry creates a registry persisted at path with the default
+// configuration and loads existing entries. Empty path keeps the registry in memory only.
+func NewClientOrderRegistry(path string) (*ClientOrderRegistry, error) {
+	return NewClientOrderRegistryWithConfig(path, ClientOrderRegistryConfig{})
+}
+
+// NewClientOrderRegistryWithConfig creates a registry persisted at path and loads existing entries.
+// Empty path keeps the registry in memory only.
+func NewClientOrderRegistryWithConfig(path string, config ClientOrderRegistryConfig) (*ClientOrderRegistry, error) {
+	if config.MaxAge <= 0 {
+		config.MaxAge = DEFAULT_CLIENT_ORDER_MAX_AGE
+	}
+	if config.FinalTTL <= 0 {
+		config.FinalTTL = DEFAULT_CLIENT_ORDER_FINAL_TTL
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DEFAULT_CLIENT_ORDER_MAX_ENTRIES
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DEFAULT_CLIENT_ORDER_FLUSH_INTERVAL
+	}
+
+	r := &ClientOrderRegistry{
+		path:     path,
+		config:   config,
+		now:      time.Now,
+		byClient: make(map[string]ClientOrderEntry),
+		byOrder:  make(map[string]string),
+	}
+
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ClientOrderEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	// Entries of older files have no time, they age from now.
+	now := r.now().UnixMilli()
+	for _, entry := range entries {
+		if entry.UpdatedAt == 0 {
+			entry.UpdatedAt = now
+		}
+		r.byClient[entry.ClientOrderId] = entry
+		r.byOrder[entry.OrderId] = entry.ClientOrderId
+	}
+
+	if r.prune() {
+		r.dirty = true
+		r.scheduleFlush()
+	}
+
+	return r, nil
+}
+
+// Register records the order of the client order ID. The file is written by the next flush.
+func (r *ClientOrderRegistry) Register(clientOrderId, marketId, orderId string) {
+	r.put(clientOrderId, marketId, orderId, "")
+}
+
+// Update records the client order ID and status of an order seen on the exchange,
+// e.g. listed or received from account@ channel. Orders seen final are evicted after FinalTTL.
+func (r *ClientOrderRegistry) Update(order *model.OrderData) {
+	if order == nil || order.ClientOrderId == nil {
+		return
+	}
+
+	r.put(*order.ClientOrderId, order.MarketID, order.OrderId, order.Status)
+}
+
+// put records an entry, keeping the known status if status is empty.
+func (r *ClientOrderRegistry) put(clientOrderId, marketId, orderId, status string) {
+	if clientOrderId == "" || orderId == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.byClient[clientOrderId]
+	if ok && entry.OrderId == orderId && (status == "" || status == entry.Status) {
+		return
+	}
+	if ok && entry.OrderId != orderId {
+		delete(r.byOrder, entry.OrderId)
+	}
+	if status == "" && entry.OrderId == orderId {
+		status = entry.Status
+	}
+
+	r.byClient[clientOrderId] = ClientOrderEntry{
+		ClientOrderId: clientOrderId,
+		OrderId:       orderId,
+		MarketId:      marketId,
+		Status:        status,
+		UpdatedAt:     r.now().UnixMilli(),
+	}
+	r.byOrder[orderId] = clientOrderId
+
+	if len(r.byClient) > r.config.MaxEntries {
+		r.prune()
+	}
+
+	r.dirty = true
+	r.scheduleFlush()
+}
+
+// Lookup returns the entry of the client order ID.
+func (r *ClientOrderRegistry) Lookup(clientOrderId string) (ClientOrderEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.byClient[clientOrderId]
+	return entry, ok
+}
+
+// ClientOrderId returns the client order ID of the exchange order.
+func (r *ClientOrderRegistry) ClientOrderId(orderId string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clientOrderId, ok := r.byOrder[orderId]
+	return clientOrderId, ok
+}
+
+// Len returns the number of client order IDs kept.
+func (r *ClientOrderRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.byClient)
+}
+
+// Flush evicts expired entries and writes pending changes to the file.
+func (r *ClientOrderRegistry) Flush() error {
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	r.mu.Lock()
+	if r.flushTimer != nil {
+		r.flushTimer.Stop()
+		r.flushTimer = nil
+	}
+	if r.prune() {
+		r.dirty = true
+	}
+	if !r.dirty || r.path == "" {
+		r.mu.Unlock()
+		return nil
+	}
+
+	entries := make([]ClientOrderEntry, 0, len(r.byClient))
+	for _, entry := range r.byClient {
+		entries = append(entries, entry)
+	}
+	r.dirty = false
+	r.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err == nil {
+		err = writeFileAtomic(r.path, data)
+	}
+	if err != nil {
+		// Written again by the next flush.
+		r.mu.Lock()
+		r.dirty = true
+		r.scheduleFlush()
+		r.mu.Unlock()
+	}
+
+	return err
+}
+
+// Close writes pending changes to the file.
+func (r *ClientOrderRegistry) Close() error {
+	return r.Flush()
+}
+
+// scheduleFlush flushes after FlushInterval unless a flush is already scheduled. Caller must hold mu.
+func (r *ClientOrderRegistry) scheduleFlush() {
+	if r.path == "" || r.flushTimer != nil {
+		return
+	}
+
+	r.flushTimer = time.AfterFunc(r.config.FlushInterval, func() {
+		if err := r.Flush(); err != nil {
+			logrus.Errorf("Failed to save client order registry: %s", err)
+		}
+	})
+}
+
+// prune evicts expired entries and the oldest ones beyond MaxEntries.
+// It reports whether any entry was evicted. Caller must hold mu.
+func (r *ClientOrderRegistry) prune() bool {
+	now := r.now().UnixMilli()
+	before := len(r.byClient)
+
+	for id, entry := range r.byClient {
+		age := time.Duration(now-entry.UpdatedAt) * time.Millisecond
+		if age > r.config.MaxAge || (isFinal(entry.Status) && age > r.config.FinalTTL) {
+			r.remove(id)
+		}
+	}
+
+	if excess := len(r.byClient) - r.config.MaxEntries; excess > 0 {
+		entries := make([]ClientOrderEntry, 0, len(r.byClient))
+		for _, entry := range r.byClient {
+			entries = append(entries, entry)
+		}
+
+		// Final orders go first, then the least recently updated.
+		sort.Slice(entries, func(i, j int) bool {
+			fi, fj := isFinal(entries[i].Status), isFinal(entries[j].Status)
+			if fi != fj {
+				return fi
+			}
+			return entries[i].UpdatedAt < entries[j].UpdatedAt
+		})
+
+		for _, entry := range entries[:excess] {
+			r.remove(entry.ClientOrderId)
+		}
+	}
+
+	return len(r.byClient) != before
+}
+
+// remove deletes the entry of the client order ID. Caller must hold mu.
+func (r *ClientOrderRegistry) remove(clientOrderId string) {
+	if entry, ok := r.byClient[clientOrderId]; ok {
+		delete(r.byOrder, entry.OrderId)
+		delete(r.byClient, clientOrderId)
+	}
+}
+
+// SetClientOrderRegistry sets the registry used to record and resolve client order IDs.
+// With a registry set, CreateOrder rejects client order IDs already registered,
+// CancelOrder resolves the order ID from the client order ID
+// and ListOrders and PublishOrderUpdate record client order IDs and statuses of seen orders.
+func (c *RbClient) SetClientOrderRegistry(registry *ClientOrderRegistry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clientOrders = registry
+}
+
+// FindOrderByClientId returns the order with the client order ID.
+// The exchange is asked by client order ID first, then by the order ID known to the registry.
+func (c *RbClient) FindOrderByClientId(marketId, clientOrderId string) (*model.OrderData, error) {
+	orders, err := c.ListOrders(&OrderListRequest{
+		MarketId:      marketId,
+		ClientOrderId: clientOrderId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		if orders[i].ClientOrderId != nil && *orders[i].ClientOrderId == clientOrderId {
+			return &orders[i], nil
+		}
+	}
+
+	if registry := c.clientOrderRegistry(); registry != nil {
+		if entry, ok := registry.Lookup(clientOrderId); ok {
+			return c.GetOrder(entry.MarketId, entry.OrderId)
+		}
+	}
+
+	return nil, fmt.Errorf("order with client order ID %s not found", clientOrderId)
+}
+
+// clientOrderRegistry returns the registry set on the client, if any.
+func (c *RbClient) clientOrderRegistry() *ClientOrderRegistry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.clientOrders
+}
+
+// checkClientOrderId rejects client order IDs already registered.
+func (c *RbClient) checkClientOrderId(clientOrderId *string) error {
+	registry := c.clientOrderRegistry()
+	if registry == nil || clientOrderId == nil || *clientOrderId == "" {
+		return nil
+	}
+
+	if entry, ok := registry.Lookup(*clientOrderId); ok {
+		return fmt.Errorf("%w: %s is order %s", ErrDuplicateClientOrderId, *clientOrderId, entry.OrderId)
+	}
+
+	return nil
+}
+
+// registerClientOrderId records the created order in the registry.
+func (c *RbClient) registerClientOrderId(clientOrderId *string, marketId, orderId string) {
+	registry := c.clientOrderRegistry()
+	if registry == nil || clientOrderId == nil {
+		return
+	}
+
+	registry.Register(*clientOrderId, marketId, orderId)
+}
+
+// updateClientOrder records the client order ID and status of an order seen on the exchange.
+func (c *RbClient) updateClientOrder(order *model.OrderData) {
+	if registry := c.clientOrderRegistry(); registry != nil {
+		registry.Update(order)
+	}
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"rabbitx-client/model"
+	"testing"
+	"time"
+)
+
+// newTestRegistry returns a registry at path with a fake clock at now.
+func newTestRegistry(t *testing.T, path string, config ClientOrderRegistryConfig, now *time.Time) *ClientOrderRegistry {
+	t.Helper()
+
+	r, err := NewClientOrderRegistryWithConfig(path, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.now = func() time.Time { return *now }
+	t.Cleanup(func() { r.Close() })
+
+	return r
+}
+
+func TestClientOrderRegistryEviction(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := newTestRegistry(t, "", ClientOrderRegistryConfig{MaxAge: 24 * time.Hour, FinalTTL: time.Minute, MaxEntries: 3}, &now)
+
+	clientId := func(id string) *string { return &id }
+
+	r.Register("open", "BTC-USD", "1")
+	r.Register("closed", "BTC-USD", "2")
+	r.Update(&model.OrderData{OrderId: "2", MarketID: "BTC-USD", Status: model.CLOSED, ClientOrderId: clientId("closed")})
+
+	// A registration without status keeps the known one.
+	r.Register("closed", "BTC-USD", "2")
+
+	now = now.Add(2 * time.Minute)
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Lookup("closed"); ok {
+		t.Error("final order kept after FinalTTL")
+	}
+	if _, ok := r.ClientOrderId("2"); ok {
+		t.Error("order ID of the evicted entry still resolves")
+	}
+	if _, ok := r.Lookup("open"); !ok {
+		t.Error("open order evicted before MaxAge")
+	}
+
+	// The oldest entries go beyond MaxEntries.
+	for _, id := range []string{"a", "b", "c"} {
+		now = now.Add(time.Second)
+		r.Register(id, "BTC-USD", "order-"+id)
+	}
+	if n := r.Len(); n != 3 {
+		t.Errorf("Len() = %d, want 3", n)
+	}
+	if _, ok := r.Lookup("open"); ok {
+		t.Error("oldest entry kept beyond MaxEntries")
+	}
+
+	now = now.Add(25 * time.Hour)
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Len(); n != 0 {
+		t.Errorf("Len() after MaxAge = %d, want 0", n)
+	}
+}
+
+func TestClientOrderRegistryBatchedWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client_orders.json")
+	// Loading prunes by the system clock.
+	now := time.Now().Truncate(time.Millisecond)
+	r := newTestRegistry(t, path, ClientOrderRegistryConfig{FlushInterval: time.Hour}, &now)
+
+	for _, id := range []string{"a", "b", "c"} {
+		r.Register(id, "BTC-USD", "order-"+id)
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file written before the flush, stat error = %v", err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestRegistry(t, path, ClientOrderRegistryConfig{}, &now)
+	if entry, ok := loaded.Lookup("b"); !ok || entry.OrderId != "order-b" || entry.UpdatedAt != now.UnixMilli() {
+		t.Errorf("Lookup(b) = %+v, %v, want order-b registered at %d", entry, ok, now.UnixMilli())
+	}
+}
+
+func TestClientOrderRegistryLoadsEntriesWithoutTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client_orders.json")
+	data := `[{"client_order_id":"a","order_id":"1","market_id":"BTC-USD"}]`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewClientOrderRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, ok := r.Lookup("a"); !ok {
+		t.Error("entry without time evicted on load")
+	}
+}
+
+func TestHasClientOrderTag(t *testing.T) {
+	g, err := NewClientOrderIdGenerator("mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		clientOrderId string
+		want          bool
+	}{
+		{"generated", g.Next(), true},
+		{"other session", "mm-0badf00d-7", true},
+		{"longer tag", "mmx-0badf00d-7", false},
+		{"other tag", "dummy-0badf00d-7", false},
+		{"tag only", "mm", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasClientOrderTag(tt.clientOrderId, g.Tag()); got != tt.want {
+				t.Errorf("HasClientOrderTag(%q, %q) = %t, want %t", tt.clientOrderId, g.Tag(), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MAX_CLOCK_SKEW is the local/server clock difference above which a warning is logged.
+const MAX_CLOCK_SKEW = 5 * time.Second
+
+// Clock is the source of local time used by the client.
+// It can be replaced with SetClock, e.g. to run against a fake clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default Clock backed by time.Now.
+type systemClock struct{}
+
+// Now returns the current local time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock replaces the local clock used for signatures and expiry checks.
+// The estimated server offset is reset.
+func (c *RbClient) SetClock(clock Clock) {
+	c.muClock.Lock()
+	defer c.muClock.Unlock()
+
+	c.clock = clock
+	c.clockOffset = 0
+	c.clockBounds = nil
+}
+
+// ClockOffset returns the estimated difference between server and local time.
+// A positive value means the local clock is behind the server.
+func (c *RbClient) ClockOffset() time.Duration {
+	c.muClock.RLock()
+	defer c.muClock.RUnlock()
+
+	return c.clockOffset
+}
+
+// SyncClock performs a request to a public endpoint in order to refresh
+// the server clock offset and returns the new estimate.
+func (c *RbClient) SyncClock() (time.Duration, error) {
+	if _, err := c.get(PATH_MARKETS, nil, nil); err != nil {
+		return 0, err
+	}
+
+	return c.ClockOffset(), nil
+}
+
+// now returns the local time corrected by the estimated server offset.
+func (c *RbClient) now() time.Time {
+	c.muClock.RLock()
+	defer c.muClock.RUnlock()
+
+	return c.clock.Now().Add(c.clockOffset)
+}
+
+// localNow returns the uncorrected local time.
+func (c *RbClient) localNow() time.Time {
+	c.muClock.RLock()
+	defer c.muClock.RUnlock()
+
+	return c.clock.Now()
+}
+
+// clockBounds is the range of server offsets consistent with the observed Date headers.
+type clockBounds struct {
+	low  time.Duration // The smallest possible offset.
+	high time.Duration // The largest possible offset.
+}
+
+// observeServerTime updates the clock offset from the Date header of a response.
+// sentAt and receivedAt are local times taken around the round-trip. The header has
+// one second resolution, so a response only bounds the offset: the server time lies
+// within the header second and was read between sentAt and receivedAt. The bounds of
+// all responses are intersected and the offset is their midpoint, which becomes more
+// precise than the header as responses fall on different fractions of a second.
+// Bounds disjoint from the previous ones mean a clock jumped, the estimate then restarts.
+func (c *RbClient) observeServerTime(resp *http.Response, sentAt, receivedAt time.Time) {
+	dateHeader := resp.Header.Get("Date")
+	if dateHeader == "" {
+		return
+	}
+
+	serverTime, err := http.ParseTime(dateHeader)
+	if err != nil {
+		return
+	}
+
+	sample := clockBounds{
+		low:  serverTime.Sub(receivedAt),
+		high: serverTime.Add(time.Second).Sub(sentAt),
+	}
+
+	c.muClock.Lock()
+	defer c.muClock.Unlock()
+
+	bounds := c.clockBounds
+	if bounds == nil || sample.high < bounds.low || sample.low > bounds.high {
+		bounds = &sample
+	} else {
+		bounds = &clockBounds{
+			low:  maxDuration(bounds.low, sample.low),
+			high: minDuration(bounds.high, sample.high),
+		}
+	}
+	c.clockBounds = bounds
+
+	prev := c.clockOffset
+	offset := bounds.low + (bounds.high-bounds.low)/2
+	c.clockOffset = offset
+
+	if offset.Abs() > MAX_CLOCK_SKEW && (offset-prev).Abs() >= time.Second {
+		logrus.
+			WithField("offset", offset.String()).
+			Warn("Local clock differs from server time, signatures are adjusted by the offset")
+	}
+}
+
+// maxDuration returns the larger duration.
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// minDuration returns the smaller duration.
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock set by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now returns the time of the fake clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// add moves the fake clock.
+func (c *fakeClock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// observeAt feeds a response sent at the local time of the clock, read by the server
+// at local time + offset and received rtt later.
+func observeAt(c *RbClient, clock *fakeClock, offset, rtt time.Duration) {
+	sentAt := clock.Now()
+	serverTime := sentAt.Add(rtt / 2).Add(offset)
+	clock.add(rtt)
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Date", serverTime.UTC().Format(http.TimeFormat))
+	c.observeServerTime(resp, sentAt, clock.Now())
+}
+
+func TestClockOffsetBelowHeaderResolution(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	c := NewRbClient("", "", "", "", "", "", "", 0)
+	c.SetClock(clock)
+
+	offset := 300 * time.Millisecond
+	for i := 0; i < 20; i++ {
+		observeAt(c, clock, offset, 20*time.Millisecond)
+		clock.add(1370 * time.Millisecond)
+	}
+
+	if got := c.ClockOffset(); (got - offset).Abs() > 50*time.Millisecond {
+		t.Errorf("offset = %s, want %s within 50ms", got, offset)
+	}
+
+	// A slow response does not move a precise estimate.
+	observeAt(c, clock, offset, 3*time.Second)
+	if got := c.ClockOffset(); (got - offset).Abs() > 50*time.Millisecond {
+		t.Errorf("offset after a slow response = %s, want %s within 50ms", got, offset)
+	}
+
+	// A clock jump restarts the estimate.
+	jumped := -10 * time.Second
+	observeAt(c, clock, jumped, 20*time.Millisecond)
+	if got := c.ClockOffset(); (got - jumped).Abs() > time.Second {
+		t.Errorf("offset after a jump = %s, want %s within 1s", got, jumped)
+	}
+}
+
+func TestSyncClock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testMarketsResponse))
+	}))
+	defer server.Close()
+
+	// The local clock is an hour behind the server.
+	clock := &fakeClock{now: time.Now().Add(-time.Hour)}
+	c := NewPublicClient(Environment{Name: ENV_CUSTOM, ApiUrl: server.URL})
+	c.SetClock(clock)
+
+	offset, err := c.SyncClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (offset - time.Hour).Abs() > 2*time.Second {
+		t.Errorf("offset = %s, want 1h within 2s", offset)
+	}
+	if now := c.now(); now.Sub(time.Now()).Abs() > 2*time.Second {
+		t.Errorf("corrected time = %s, want the server time", now)
+	}
+}
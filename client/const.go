@@ -27,6 +27,9 @@ const (
 	// PATH_MARKETS is the API path for markets.
 	PATH_MARKETS = "/markets"
 
+	// PATH_ORDERBOOK is the API path for orderbook snapshots.
+	PATH_ORDERBOOK = "/markets/orderbook"
+
 	// PATH_ORDERS is the API path for orders.
 	PATH_ORDERS = "/orders"
 
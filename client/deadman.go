@@ -0,0 +1,232 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// Default dead man's switch settings.
+const (
+	// DEFAULT_HEARTBEAT_TIMEOUT is the time without heartbeats after which orders are canceled.
+	DEFAULT_HEARTBEAT_TIMEOUT = 30 * time.Second
+
+	// DEFAULT_DISCONNECT_GRACE is the time a websocket may stay disconnected before orders are canceled.
+	DEFAULT_DISCONNECT_GRACE = 10 * time.Second
+)
+
+// Dead man's switch trigger reasons.
+const (
+	// DEADMAN_HEARTBEAT_TIMEOUT means the application stopped sending heartbeats.
+	DEADMAN_HEARTBEAT_TIMEOUT = "heartbeat_timeout"
+
+	// DEADMAN_DISCONNECTED means the websocket stayed disconnected longer than the grace period.
+	DEADMAN_DISCONNECTED = "disconnected"
+)
+
+// DeadManConfig configures a DeadManSwitch.
+type DeadManConfig struct {
+	Markets          []string                       // The markets to cancel orders in, all markets if empty.
+	HeartbeatTimeout time.Duration                  // The heartbeat timeout, DEFAULT_HEARTBEAT_TIMEOUT if zero.
+	DisconnectGrace  time.Duration                  // The disconnect grace period, DEFAULT_DISCONNECT_GRACE if zero.
+	OnTrigger        func(reason string, err error) // The optional alert hook called on every cancel attempt, err is the cancel error if any.
+}
+
+// DeadManSwitch cancels resting orders when the application stalls or loses connectivity.
+// Each part of the application sends heartbeats from its own source with HeartbeatFrom,
+// e.g. one per market listener, and is watched from its first heartbeat, so one stalled
+// source is detected while the others are alive. Websocket state is reported with
+// Disconnected and Connected. A stall fires once its cancel succeeds, failed cancels
+// are retried on every check. It is armed again by the next heartbeat of the source
+// or by the reconnect.
+type DeadManSwitch struct {
+	client         *RbClient
+	config         DeadManConfig
+	mu             sync.Mutex
+	heartbeats     map[string]time.Time
+	disconnectedAt time.Time
+	fired          map[string]bool
+	done           chan struct{}
+	stopOnce       sync.Once
+}
+
+// deadManStall is a reason to fire and the markets to cancel orders in, all configured if empty.
+type deadManStall struct {
+	key     string
+	reason  string
+	markets []string
+}
+
+// NewDeadManSwitch creates a new DeadManSwitch canceling orders with the given client.
+func NewDeadManSwitch(client *RbClient, config DeadManConfig) *DeadManSwitch {
+	if config.HeartbeatTimeout <= 0 {
+		config.HeartbeatTimeout = DEFAULT_HEARTBEAT_TIMEOUT
+	}
+
+	if config.DisconnectGrace <= 0 {
+		config.DisconnectGrace = DEFAULT_DISCONNECT_GRACE
+	}
+
+	return &DeadManSwitch{
+		client:     client,
+		config:     config,
+		heartbeats: make(map[string]time.Time),
+		fired:      make(map[string]bool),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start starts watching heartbeats.
+func (d *DeadManSwitch) Start() {
+	go d.run()
+}
+
+// Stop stops the switch without canceling orders.
+func (d *DeadManSwitch) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+	})
+}
+
+// Heartbeat reports that the application is alive, it is a heartbeat of the unnamed source.
+func (d *DeadManSwitch) Heartbeat() {
+	d.HeartbeatFrom("")
+}
+
+// HeartbeatFrom reports that the source is alive. If the source is one of the configured
+// markets, only orders of that market are canceled when it stalls.
+func (d *DeadManSwitch) HeartbeatFrom(source string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.heartbeats[source] = d.client.localNow()
+	delete(d.fired, heartbeatKey(source))
+}
+
+// Disconnected reports that the websocket connection is lost.
+func (d *DeadManSwitch) Disconnected() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.disconnectedAt.IsZero() {
+		d.disconnectedAt = d.client.localNow()
+	}
+}
+
+// Connected reports that the websocket connection is established.
+func (d *DeadManSwitch) Connected() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.disconnectedAt = time.Time{}
+	delete(d.fired, DEADMAN_DISCONNECTED)
+}
+
+// run checks for timeouts until stopped.
+func (d *DeadManSwitch) run() {
+	interval := d.config.DisconnectGrace
+	if d.config.HeartbeatTimeout < interval {
+		interval = d.config.HeartbeatTimeout
+	}
+
+	ticker := time.NewTicker(interval / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.tick()
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// tick fires the switch for every stall which has not fired yet.
+func (d *DeadManSwitch) tick() {
+	for _, stall := range d.check() {
+		if err := d.trigger(stall); err != nil {
+			continue
+		}
+
+		d.mu.Lock()
+		d.fired[stall.key] = true
+		d.mu.Unlock()
+	}
+}
+
+// check returns the stalls which have not fired yet.
+func (d *DeadManSwitch) check() []deadManStall {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.client.localNow()
+
+	var stalls []deadManStall
+	for source, last := range d.heartbeats {
+		key := heartbeatKey(source)
+		if d.fired[key] || now.Sub(last) <= d.config.HeartbeatTimeout {
+			continue
+		}
+
+		stall := deadManStall{key: key, reason: DEADMAN_HEARTBEAT_TIMEOUT}
+		if slices.Contains(d.config.Markets, source) {
+			stall.markets = []string{source}
+		}
+		stalls = append(stalls, stall)
+	}
+
+	if !d.disconnectedAt.IsZero() && !d.fired[DEADMAN_DISCONNECTED] && now.Sub(d.disconnectedAt) > d.config.DisconnectGrace {
+		stalls = append(stalls, deadManStall{key: DEADMAN_DISCONNECTED, reason: DEADMAN_DISCONNECTED})
+	}
+
+	return stalls
+}
+
+// trigger cancels orders of the stall and calls the alert hook. It returns the cancel error.
+func (d *DeadManSwitch) trigger(stall deadManStall) error {
+	logrus.Warnf("Dead man's switch triggered (%s), canceling orders", stall.key)
+
+	markets := stall.markets
+	if len(markets) == 0 {
+		markets = d.config.Markets
+	}
+
+	var err error
+	if len(markets) == 0 {
+		err = d.client.CancelAllOrders()
+	} else {
+		var errs []error
+		for _, marketId := range markets {
+			canceled, e := d.client.CancelMarketOrders(marketId)
+			if e != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", marketId, e))
+			}
+			logrus.Infof("Dead man's switch canceled %d orders in %s", canceled, marketId)
+		}
+		err = errors.Join(errs...)
+	}
+
+	if err != nil {
+		logrus.Errorf("Dead man's switch failed to cancel orders, retrying: %s", err)
+	}
+
+	if d.config.OnTrigger != nil {
+		d.config.OnTrigger(stall.reason, err)
+	}
+
+	return err
+}
+
+// heartbeatKey returns the key of a heartbeat timeout of the source.
+func heartbeatKey(source string) string {
+	if source == "" {
+		return DEADMAN_HEARTBEAT_TIMEOUT
+	}
+
+	return DEADMAN_HEARTBEAT_TIMEOUT + ":" + source
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCancels serves the cancel requests of a dead man's switch, one open order per market.
+type fakeCancels struct {
+	mu       sync.Mutex
+	failures int
+	calls    []string
+}
+
+// ServeHTTP implements http.Handler.
+func (f *fakeCancels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == PATH_ORDERS && r.Method == http.MethodGet:
+		marketId := r.URL.Query().Get("market_id")
+		w.Write([]byte(`{"success":true,"error":"","result":[{"id":"` + marketId + `-1","market_id":"` + marketId + `","status":"open"}]}`))
+		return
+	case r.Method != http.MethodDelete:
+		http.NotFound(w, r)
+		return
+	}
+
+	if f.failures > 0 {
+		f.failures--
+		w.Write([]byte(`{"success":false,"error":"temporarily unavailable","result":[]}`))
+		return
+	}
+
+	if r.URL.Path == PATH_ORDERS_CANCEL_ALL {
+		f.calls = append(f.calls, "cancel all")
+	} else {
+		var req OrderCancelRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.calls = append(f.calls, "cancel "+req.MarketId)
+	}
+	w.Write([]byte(`{"success":true,"error":"","result":[{"id":"1","status":"canceled"}]}`))
+}
+
+// callLog returns the cancel requests received since the last call.
+func (f *fakeCancels) callLog() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := f.calls
+	f.calls = nil
+
+	return calls
+}
+
+// fail makes the next n cancel requests fail.
+func (f *fakeCancels) fail(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures = n
+}
+
+// newTestDeadMan returns a dead man's switch on a fake clock, its cancels and the hook calls.
+func newTestDeadMan(t *testing.T, markets []string) (*DeadManSwitch, *fakeClock, *fakeCancels, *[]string) {
+	t.Helper()
+
+	f := &fakeCancels{}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	// The clock stays close to the server, its Date headers correct the offset of the client.
+	clock := &fakeClock{now: time.Now()}
+	expires := clock.now.Add(24 * time.Hour).Unix()
+	c := NewRbClient(server.URL, "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", "", "key", "0x01", "token", "", expires)
+	c.SetClock(clock)
+
+	var reasons []string
+	d := NewDeadManSwitch(c, DeadManConfig{
+		Markets:          markets,
+		HeartbeatTimeout: 30 * time.Second,
+		DisconnectGrace:  10 * time.Second,
+		OnTrigger: func(reason string, err error) {
+			if err != nil {
+				reason += " failed"
+			}
+			reasons = append(reasons, reason)
+		},
+	})
+
+	return d, clock, f, &reasons
+}
+
+func TestDeadManSwitchRetriesFailedCancel(t *testing.T) {
+	d, clock, f, reasons := newTestDeadMan(t, nil)
+
+	d.Heartbeat()
+	d.Disconnected()
+	clock.add(11 * time.Second)
+
+	f.fail(1)
+	d.tick()
+	d.tick()
+	d.tick()
+
+	if want, got := []string{"cancel all"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+	if want := []string{DEADMAN_DISCONNECTED + " failed", DEADMAN_DISCONNECTED}; !reflect.DeepEqual(*reasons, want) {
+		t.Errorf("hook calls = %v, want %v", *reasons, want)
+	}
+
+	// Heartbeats do not arm a switch fired by the disconnect, the reconnect does.
+	d.Heartbeat()
+	d.tick()
+	if calls := f.callLog(); len(calls) != 0 {
+		t.Errorf("requests after heartbeat = %v, want none", calls)
+	}
+
+	d.Connected()
+	d.Disconnected()
+	clock.add(11 * time.Second)
+	d.Heartbeat()
+	d.tick()
+	if want, got := []string{"cancel all"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests after the second disconnect = %v, want %v", got, want)
+	}
+}
+
+func TestDeadManSwitchHeartbeatsPerMarket(t *testing.T) {
+	d, clock, f, _ := newTestDeadMan(t, []string{"BTC-USD", "ETH-USD"})
+
+	d.HeartbeatFrom("BTC-USD")
+	d.HeartbeatFrom("ETH-USD")
+
+	// The ETH-USD listener stalls while BTC-USD keeps beating.
+	for i := 0; i < 4; i++ {
+		clock.add(10 * time.Second)
+		d.HeartbeatFrom("BTC-USD")
+		d.tick()
+	}
+
+	if want, got := []string{"cancel ETH-USD"}, f.callLog(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+
+	// The stall fires once and is armed again by the next heartbeat of the source.
+	clock.add(10 * time.Second)
+	d.HeartbeatFrom("BTC-USD")
+	d.tick()
+	if calls := f.callLog(); len(calls) != 0 {
+		t.Errorf("requests after firing = %v, want none", calls)
+	}
+
+	d.HeartbeatFrom("ETH-USD")
+	clock.add(31 * time.Second)
+	d.tick()
+	if want, got := []string{"cancel BTC-USD", "cancel ETH-USD"}, sortedCalls(f.callLog()); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests after both stalled = %v, want %v", got, want)
+	}
+}
+
+// sortedCalls returns the requests in order, stalls of several sources fire in any order.
+func sortedCalls(calls []string) []string {
+	sort.Strings(calls)
+	return calls
+}
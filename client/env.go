@@ -0,0 +1,222 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Names of environment presets.
+const (
+	// ENV_TESTNET is the name of the testnet environment.
+	ENV_TESTNET = "testnet"
+
+	// ENV_MAINNET is the name of the mainnet environment.
+	ENV_MAINNET = "mainnet"
+
+	// ENV_CUSTOM is the name of an environment configured by API_URL, WS_URL and CHAIN_ID.
+	ENV_CUSTOM = "custom"
+)
+
+// ErrMainnetNotAllowed is returned when an order is sent to mainnet without AllowMainnet.
+var ErrMainnetNotAllowed = errors.New("trading on mainnet is not allowed, enable it explicitly with AllowMainnet")
+
+// Environment bundles endpoints and chain settings of one RabbitX deployment.
+type Environment struct {
+	Name            string // The name of the environment.
+	ApiUrl          string // The REST API URL.
+	WsUrl           string // The websocket URL.
+	ChainId         int64  // The ID of the chain the exchange settles on.
+	ExchangeAddress string // The address of the exchange contract, empty if unknown.
+	TokenAddress    string // The address of the collateral token contract, empty if unknown.
+	Mainnet         bool   // Whether real funds are traded.
+}
+
+// Environment presets. Contract addresses are not bundled: no published source
+// for them is available to this package, and a wrong address would send funds
+// to the wrong contract. EnvironmentFromEnv reads them from EXCHANGE_ADDRESS
+// and TOKEN_ADDRESS for every environment.
+var (
+	// Testnet is the RabbitX testnet.
+	Testnet = Environment{
+		Name:    ENV_TESTNET,
+		ApiUrl:  "https://api.testnet.rabbitx.io",
+		WsUrl:   "wss://api.testnet.rabbitx.io/ws",
+		ChainId: 11155111,
+	}
+
+	// Mainnet is the RabbitX mainnet.
+	Mainnet = Environment{
+		Name:    ENV_MAINNET,
+		ApiUrl:  "https://api.prod.rabbitx.io",
+		WsUrl:   "wss://api.prod.rabbitx.io/ws",
+		ChainId: 1,
+		Mainnet: true,
+	}
+)
+
+// LookupEnvironment returns the preset with the given name.
+func LookupEnvironment(name string) (Environment, error) {
+	switch name {
+	case ENV_TESTNET:
+		return Testnet, nil
+	case ENV_MAINNET:
+		return Mainnet, nil
+	}
+
+	return Environment{}, fmt.Errorf("unknown environment %q", name)
+}
+
+// EnvironmentFromEnv selects the environment by the RABBITX_ENV variable.
+// "custom" reads API_URL, WS_URL and CHAIN_ID. Every environment reads its contract
+// addresses from EXCHANGE_ADDRESS and TOKEN_ADDRESS, which must be hex addresses if set.
+// If RABBITX_ENV is not set, custom is used when API_URL is set and testnet otherwise.
+func EnvironmentFromEnv() (Environment, error) {
+	env, err := environmentFromEnv()
+	if err != nil {
+		return Environment{}, err
+	}
+
+	for name, address := range map[string]*string{"EXCHANGE_ADDRESS": &env.ExchangeAddress, "TOKEN_ADDRESS": &env.TokenAddress} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if !common.IsHexAddress(value) {
+			return Environment{}, fmt.Errorf("%s is not an address: %q", name, value)
+		}
+		*address = value
+	}
+
+	return env, nil
+}
+
+// environmentFromEnv selects the environment and reads the custom one without contract addresses.
+func environmentFromEnv() (Environment, error) {
+	name := os.Getenv("RABBITX_ENV")
+	if name == "" {
+		name = ENV_TESTNET
+		if os.Getenv("API_URL") != "" {
+			name = ENV_CUSTOM
+		}
+	}
+
+	if name != ENV_CUSTOM {
+		return LookupEnvironment(name)
+	}
+
+	env := Environment{
+		Name:   ENV_CUSTOM,
+		ApiUrl: os.Getenv("API_URL"),
+		WsUrl:  os.Getenv("WS_URL"),
+	}
+
+	if env.ApiUrl == "" || env.WsUrl == "" {
+		return Environment{}, errors.New("custom environment requires API_URL and WS_URL")
+	}
+
+	if chainId := os.Getenv("CHAIN_ID"); chainId != "" {
+		id, err := strconv.ParseInt(chainId, 10, 64)
+		if err != nil {
+			return Environment{}, fmt.Errorf("failed to parse CHAIN_ID: %w", err)
+		}
+		env.ChainId = id
+	}
+
+	env.Mainnet = isMainnet(env)
+
+	return env, nil
+}
+
+// isMainnet reports whether the environment trades real funds: it settles on the mainnet
+// chain or any of its URLs points to a mainnet host, whatever the chain setting says.
+func isMainnet(env Environment) bool {
+	if env.ChainId == Mainnet.ChainId {
+		return true
+	}
+
+	return isMainnetUrl(env.ApiUrl) || isMainnetUrl(env.WsUrl)
+}
+
+// isMainnetUrl reports whether the URL points to a host of the mainnet API or a subdomain
+// of it. Hosts are compared case-insensitively without port and trailing dot,
+// so path, slash and scheme variations of the preset URLs are recognised.
+func isMainnetUrl(rawUrl string) bool {
+	host := urlHost(rawUrl)
+	if host == "" {
+		return false
+	}
+
+	for _, preset := range []string{Mainnet.ApiUrl, Mainnet.WsUrl} {
+		mainnetHost := urlHost(preset)
+		if host == mainnetHost || strings.HasSuffix(host, "."+mainnetHost) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urlHost returns the normalised host of the URL, empty if it has none.
+func urlHost(rawUrl string) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// NewRbClientForEnvironment creates a new RbClient for the environment and credentials.
+// Orders on mainnet environments are rejected until AllowMainnet is called.
+func NewRbClientForEnvironment(env Environment, creds *Credentials) *RbClient {
+	c := NewRbClient(
+		env.ApiUrl,
+		creds.Wallet,
+		creds.PrivateKey,
+		creds.APIKey,
+		creds.APISecret,
+		creds.RefreshToken,
+		creds.JwtPrivate,
+		creds.KeyExpired)
+	c.env = env
+	c.env.Mainnet = env.Mainnet || isMainnet(env)
+
+	return c
+}
+
+// Environment returns the environment of the client.
+// Clients created by NewRbClient have a custom environment with the API URL only.
+func (c *RbClient) Environment() Environment {
+	return c.env
+}
+
+// AllowMainnet enables or disables creating and amending orders on mainnet.
+func (c *RbClient) AllowMainnet(allow bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.allowMainnet = allow
+}
+
+// checkTradingAllowed returns ErrMainnetNotAllowed if the client trades on mainnet without opt-in.
+func (c *RbClient) checkTradingAllowed() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.env.Mainnet && !c.allowMainnet {
+		return ErrMainnetNotAllowed
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package client
+
+import "testing"
+
+func TestIsMainnetUrl(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://api.prod.rabbitx.io", true},
+		{"https://api.prod.rabbitx.io/", true},
+		{"https://API.Prod.RabbitX.io/markets", true},
+		{"https://api.prod.rabbitx.io.:443", true},
+		{"http://api.prod.rabbitx.io", true},
+		{"api.prod.rabbitx.io", true},
+		{"wss://api.prod.rabbitx.io/ws", true},
+		{"https://eu.api.prod.rabbitx.io", true},
+		{" https://api.prod.rabbitx.io ", true},
+		{"https://api.testnet.rabbitx.io", false},
+		{"https://api.prod.rabbitx.io.example.com", false},
+		{"https://notapi.prod.rabbitx.io", false},
+		{"http://localhost:8080", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isMainnetUrl(tt.url); got != tt.want {
+			t.Errorf("isMainnetUrl(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestEnvironmentFromEnvMainnet(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiUrl  string
+		wsUrl   string
+		chainId string
+		want    bool
+	}{
+		{"testnet", "https://api.testnet.rabbitx.io", "wss://api.testnet.rabbitx.io/ws", "", false},
+		{"mainnet url with slash", "https://api.prod.rabbitx.io/", "wss://api.testnet.rabbitx.io/ws", "", true},
+		{"mainnet websocket", "http://localhost:8080", "wss://api.prod.rabbitx.io/ws", "", true},
+		{"mainnet chain", "http://localhost:8080", "ws://localhost:8080/ws", "1", true},
+		{"mainnet url on testnet chain", "https://api.prod.rabbitx.io", "wss://api.prod.rabbitx.io/ws", "11155111", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RABBITX_ENV", ENV_CUSTOM)
+			t.Setenv("API_URL", tt.apiUrl)
+			t.Setenv("WS_URL", tt.wsUrl)
+			t.Setenv("CHAIN_ID", tt.chainId)
+
+			env, err := EnvironmentFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.Mainnet != tt.want {
+				t.Errorf("Mainnet = %v, want %v", env.Mainnet, tt.want)
+			}
+
+			c := NewPublicClient(Environment{Name: ENV_CUSTOM, ApiUrl: tt.apiUrl, WsUrl: tt.wsUrl})
+			if tt.chainId == "" && c.Environment().Mainnet != tt.want {
+				t.Errorf("client Mainnet = %v, want %v", c.Environment().Mainnet, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvironmentFromEnvAddresses(t *testing.T) {
+	const exchange = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+
+	t.Setenv("RABBITX_ENV", ENV_TESTNET)
+	t.Setenv("EXCHANGE_ADDRESS", exchange)
+	t.Setenv("TOKEN_ADDRESS", "")
+
+	env, err := EnvironmentFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ApiUrl != Testnet.ApiUrl || env.ExchangeAddress != exchange || env.TokenAddress != "" {
+		t.Errorf("environment = %+v, want testnet with exchange address %s", env, exchange)
+	}
+	if Testnet.ExchangeAddress != "" {
+		t.Error("preset changed by the environment")
+	}
+
+	t.Setenv("TOKEN_ADDRESS", "0x1234")
+	if _, err := EnvironmentFromEnv(); err == nil {
+		t.Error("invalid TOKEN_ADDRESS: expected error")
+	}
+}
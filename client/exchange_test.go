@@ -0,0 +1,144 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"rabbitx-client/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// fakeExchange serves markets, orders and the account of a single profile.
+type fakeExchange struct {
+	mu          sync.Mutex
+	orders      map[string]*model.OrderData
+	positions   []*model.PositionData
+	calls       []string
+	lastId      int
+	failCancels int
+}
+
+// newTestExchangeClient returns a trading client of a fake exchange.
+func newTestExchangeClient(t *testing.T) (*RbClient, *fakeExchange) {
+	t.Helper()
+
+	ex := &fakeExchange{orders: map[string]*model.OrderData{}}
+	server := httptest.NewServer(ex)
+	t.Cleanup(server.Close)
+
+	expires := time.Now().Add(24 * time.Hour).Unix()
+	c := NewRbClient(server.URL, "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", "", "key", "0x01", "token", "", expires)
+
+	return c, ex
+}
+
+// ServeHTTP implements http.Handler.
+func (ex *fakeExchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	var result interface{}
+	switch {
+	case r.URL.Path == PATH_MARKETS:
+		w.Write([]byte(testMarketsResponse))
+		return
+	case r.URL.Path == PATH_ACCOUNT:
+		result = &model.ProfileData{Positions: ex.positions}
+	case r.URL.Path == PATH_ORDERS && r.Method == http.MethodGet:
+		id := r.URL.Query().Get("order_id")
+		orders := []*model.OrderData{}
+		if order, ok := ex.orders[id]; ok {
+			orders = append(orders, order)
+		}
+		ex.reply(w, orders)
+		return
+	case r.URL.Path == PATH_ORDERS && r.Method == http.MethodPost:
+		var req DecimalOrderCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ex.lastId++
+		order := &model.OrderData{
+			OrderId:      fmt.Sprint(ex.lastId),
+			MarketID:     req.MarketId,
+			OrderType:    req.Type,
+			Status:       model.OPEN,
+			Side:         req.Side,
+			Price:        req.Price,
+			Size:         req.Size,
+			TriggerPrice: req.TriggerPrice,
+			SizePercent:  req.SizePercent,
+		}
+		ex.orders[order.OrderId] = order
+		ex.calls = append(ex.calls, "create "+req.Type)
+
+		result = &OrderCreateResponse{OrderId: order.OrderId, MarketId: order.MarketID, Status: order.Status,
+			Side: order.Side, Type: order.OrderType, Price: order.Price, Size: order.Size,
+			TriggerPrice: order.TriggerPrice, SizePercent: order.SizePercent}
+	case r.URL.Path == PATH_ORDERS && r.Method == http.MethodDelete:
+		var req OrderCancelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if ex.failCancels > 0 {
+			ex.failCancels--
+			w.Write([]byte(`{"success":false,"error":"temporarily unavailable","result":[]}`))
+			return
+		}
+
+		order, ok := ex.orders[req.OrderId]
+		if !ok {
+			w.Write([]byte(`{"success":false,"error":"order not found","result":[]}`))
+			return
+		}
+		order.Status = model.CANCELED
+		ex.calls = append(ex.calls, "cancel "+order.OrderType)
+
+		result = &OrderCancelResponse{OrderId: order.OrderId, MarketId: order.MarketID, Status: order.Status}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	ex.reply(w, []interface{}{result})
+}
+
+// reply writes a successful response of the result.
+func (ex *fakeExchange) reply(w http.ResponseWriter, result interface{}) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "error": "", "result": result})
+}
+
+// fill sets the filled size of an order and the position of its market.
+func (ex *fakeExchange) fill(orderId string, filled decimal.Decimal) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	order := ex.orders[orderId]
+	order.TotalFilledSize = &filled
+	ex.positions = []*model.PositionData{{MarketID: order.MarketID, Side: order.Side, Size: filled}}
+}
+
+// order returns a copy of the order.
+func (ex *fakeExchange) order(orderId string) model.OrderData {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	return *ex.orders[orderId]
+}
+
+// callLog returns the order requests received so far.
+func (ex *fakeExchange) callLog() []string {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+
+	return append([]string(nil), ex.calls...)
+}
@@ -3,23 +3,31 @@ package client
 
 // Importing necessary libraries.
 import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
 	"rabbitx-client/model"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/exp/slices"
 )
 
 // TILL_EXPIRATION is the duration before the API secret's expiration when it is considered close to expiring.
 const TILL_EXPIRATION = time.Hour * 2
 
 // isApiSecretExpired checks if the provided API secret is expired.
-// It returns true if the API secret is nil or its expiration time is less than or equal to the current time.
+// It returns true if the API secret is nil or its expiration time is less than or equal to now.
 // Otherwise, it returns false.
-func isApiSecretExpired(apiSecret *model.APISecret) bool {
+func isApiSecretExpired(apiSecret *model.APISecret, now time.Time) bool {
 	if apiSecret == nil {
 		return true
 	}
 
-	if int64(apiSecret.Expiration) <= time.Now().Unix() {
+	if int64(apiSecret.Expiration) <= now.Unix() {
 		return true
 	}
 
@@ -27,30 +35,157 @@ func isApiSecretExpired(apiSecret *model.APISecret) bool {
 }
 
 // isCloseToExpired checks if the provided API secret is close to expiring.
-// It returns true if the API secret is nil or its expiration time is less than or equal to the current time plus TILL_EXPIRATION.
+// It returns true if the API secret is nil or its expiration time is less than or equal to now plus TILL_EXPIRATION.
 // Otherwise, it returns false.
-func isCloseToExpired(apiSecret *model.APISecret) bool {
+func isCloseToExpired(apiSecret *model.APISecret, now time.Time) bool {
 	if apiSecret == nil {
 		return true
 	}
 
-	if time.Now().Add(TILL_EXPIRATION).Unix() >= int64(apiSecret.Expiration) {
+	if now.Add(TILL_EXPIRATION).Unix() >= int64(apiSecret.Expiration) {
 		return true
 	}
 
 	return false
 }
 
-// makeQueryParams converts the fields of the provided itemValue into a map of query parameters.
-// It only considers fields of type string.
-func makeQueryParams(itemValue reflect.Value) map[string]string {
-	queryParams := make(map[string]string)
+// writeFileAtomic writes data to a temporary file and renames it over the path,
+// so readers never see a partially written file. The temporary file has a unique
+// name in the same directory, so concurrent writers do not share it.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
 
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// makeQueryParams encodes the fields of the provided struct into query parameters.
+// Parameter names are taken from json tags, fields tagged "-" are skipped.
+// Strings, booleans, integers, floats and fmt.Stringer values are supported,
+// as well as pointers to them (nil is skipped) and slices (one value per element).
+// Zero values are skipped if the json or binding tag contains omitempty.
+func makeQueryParams(item interface{}) (url.Values, error) {
+	queryParams := url.Values{}
+
+	itemValue := reflect.Indirect(reflect.ValueOf(item))
+	if !itemValue.IsValid() {
+		return queryParams, nil
+	}
+
+	if itemValue.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query params: expected struct, got %s", itemValue.Kind())
+	}
+
+	itemType := itemValue.Type()
 	for i := 0; i < itemValue.NumField(); i++ {
-		if itemValue.Field(i).Kind() == reflect.String {
-			queryParams[itemValue.Type().Field(i).Name] = itemValue.Field(i).String()
+		field := itemType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omitEmpty := queryParamName(field)
+		if name == "" {
+			continue
+		}
+
+		value := itemValue.Field(i)
+		if omitEmpty && value.IsZero() {
+			continue
+		}
+
+		if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+			for j := 0; j < value.Len(); j++ {
+				str, ok, err := formatQueryValue(value.Index(j))
+				if err != nil {
+					return nil, fmt.Errorf("query param %s: %w", name, err)
+				}
+				if ok {
+					queryParams.Add(name, str)
+				}
+			}
+			continue
+		}
+
+		str, ok, err := formatQueryValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("query param %s: %w", name, err)
+		}
+		if ok {
+			queryParams.Add(name, str)
 		}
 	}
 
-	return queryParams
+	return queryParams, nil
+}
+
+// queryParamName returns the query parameter name of the field and whether it is omitempty.
+// Empty name means the field must be skipped.
+func queryParamName(field reflect.StructField) (string, bool) {
+	name := field.Name
+	omitEmpty := false
+
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		parts := strings.Split(tag, ",")
+		if parts[0] == "-" && len(parts) == 1 {
+			return "", false
+		}
+		if parts[0] != "" {
+			name = parts[0]
+		}
+		omitEmpty = slices.Contains(parts[1:], "omitempty")
+	}
+
+	if tag, ok := field.Tag.Lookup("binding"); ok {
+		omitEmpty = omitEmpty || slices.Contains(strings.Split(tag, ","), "omitempty")
+	}
+
+	return name, omitEmpty
+}
+
+// formatQueryValue formats a single value for a query string.
+// It returns false for nil pointers and interfaces.
+func formatQueryValue(value reflect.Value) (string, bool, error) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "", false, nil
+		}
+		value = value.Elem()
+	}
+
+	if value.CanInterface() {
+		if stringer, ok := value.Interface().(fmt.Stringer); ok {
+			return stringer.String(), true, nil
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits()), true, nil
+	}
+
+	return "", false, fmt.Errorf("unsupported type %s", value.Type())
 }
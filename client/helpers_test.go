@@ -0,0 +1,65 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMakeQueryParams(t *testing.T) {
+	price := 27000.5
+	decPrice := decimal.RequireFromString("27000.50")
+	clientId := "bot-1"
+
+	tests := []struct {
+		name    string
+		item    interface{}
+		want    string
+		wantErr bool
+	}{
+		{"nil", nil, "", false},
+		{"nil pointer", (*OrderListRequest)(nil), "", false},
+		{"zero order list", &OrderListRequest{}, "", false},
+		{"order list", &OrderListRequest{MarketId: "BTC-USD", TimeStamp: 1, EndTime: 2, OrderId: "7", ClientOrderId: "bot-1"},
+			"client_order_id=bot-1&end_time=2&market_id=BTC-USD&order_id=7&start_time=1", false},
+		{"order list slices", &OrderListRequest{Status: []string{"open", "closed"}, OrderType: []string{"limit"}},
+			"order_type=limit&status=open&status=closed", false},
+		{"empty slice", &OrderListRequest{Status: []string{}}, "", false},
+		{"market list", &MarketListRequest{MarketIds: []string{"BTC-USD", "ETH-USD"}}, "market_id=BTC-USD&market_id=ETH-USD", false},
+		{"zero market list", MarketListRequest{}, "", false},
+		{"orderbook", &OrderbookRequest{MarketId: "BTC-USD"}, "market_id=BTC-USD", false},
+		// Fields without omitempty are sent even when zero.
+		{"zero orderbook", &OrderbookRequest{}, "market_id=", false},
+		{"json omitempty", &OnboardingRequest{Wallet: "0x01"}, "wallet=0x01", false},
+		{"bool", &OnboardingRequest{IsClient: true}, "is_client=true", false},
+		{"nil pointers skipped", &OrderAmendRequest{OrderId: "1", MarketId: "BTC-USD"}, "market_id=BTC-USD&order_id=1", false},
+		{"float pointer", &OrderAmendRequest{OrderId: "1", MarketId: "BTC-USD", Price: &price},
+			"market_id=BTC-USD&order_id=1&price=27000.5", false},
+		{"stringer", &DecimalOrderAmendRequest{OrderId: "1", MarketId: "BTC-USD", Price: &decPrice},
+			"market_id=BTC-USD&order_id=1&price=27000.5", false},
+		{"string pointer", &OrderCreateRequest{MarketId: "BTC-USD", Type: "market", ClientOrderId: &clientId},
+			"client_order_id=bot-1&market_id=BTC-USD&type=market", false},
+		{"empty struct", &OrderCancelAllRequest{}, "", false},
+		{"not a struct", []string{"a"}, "", true},
+		{"unsupported field", &struct {
+			M map[string]string `json:"m"`
+		}{M: map[string]string{}}, "", true},
+		{"ignored and unexported fields", &struct {
+			Skip   string `json:"-"`
+			hidden string
+			Named  int
+		}{Skip: "x", hidden: "y", Named: 3}, "Named=3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeQueryParams(tt.item)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("makeQueryParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Encode() != tt.want {
+				t.Errorf("makeQueryParams() = %s, want %s", got.Encode(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"rabbitx-client/model"
+)
+
+// GetMarkets is a method that retrieves market data from the exchange.
+// If no market IDs are provided, all markets are returned.
+// The endpoint is public, so no API key is required.
+// The method returns a slice of MarketData objects and an error object.
+func (c *RbClient) GetMarkets(marketIds ...string) ([]*model.MarketData, error) {
+	respBody, err := c.get(PATH_MARKETS, &MarketListRequest{MarketIds: marketIds}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[*model.MarketData]
+
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Result, nil
+}
+
+// GetOrderbook is a method that retrieves the orderbook snapshot of a market.
+// The endpoint is public, so no API key is required.
+// The method returns a pointer to an OrderbookData object and an error object.
+func (c *RbClient) GetOrderbook(marketId string) (*model.OrderbookData, error) {
+	respBody, err := c.get(PATH_ORDERBOOK, &OrderbookRequest{MarketId: marketId}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Response[*model.OrderbookData]
+
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	if len(resp.Result) <= 0 {
+		return nil, errors.New("unexpected response: no result data")
+	}
+
+	return resp.Result[0], nil
+}
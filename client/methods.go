@@ -8,8 +8,6 @@ import (
 	"net/http"
 	"rabbitx-client/auth"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -32,7 +30,8 @@ func (c *RbClient) setHeaders(req *http.Request, headers map[string]string) {
 }
 
 // get sends a GET request to the specified path with the provided parameters and headers.
-func (c *RbClient) get(path string, params map[string]string, headers map[string]string) ([]byte, error) {
+// params is a struct encoded by makeQueryParams, nil means no query.
+func (c *RbClient) get(path string, params interface{}, headers map[string]string) ([]byte, error) {
 	url := fmt.Sprintf("%s%s", c.apiUrl, path)
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -41,18 +40,23 @@ func (c *RbClient) get(path string, params map[string]string, headers map[string
 
 	c.setHeaders(req, headers)
 
-	q := req.URL.Query()
-	for paramKey, paramValue := range params {
-		q.Add(paramKey, paramValue)
+	if params != nil {
+		q, err := makeQueryParams(params)
+		if err != nil {
+			return nil, err
+		}
+		req.URL.RawQuery = q.Encode()
 	}
-	req.URL.RawQuery = q.Encode()
 
+	sentAt := c.localNow()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	c.observeServerTime(resp, sentAt, c.localNow())
+
 	return io.ReadAll(resp.Body)
 }
 
@@ -119,12 +123,15 @@ func (c *RbClient) doRequest(req *http.Request, secret *secretKey) ([]byte, erro
 		}
 	}
 
+	sentAt := c.localNow()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	c.observeServerTime(resp, sentAt, c.localNow())
+
 	data, err := io.ReadAll(resp.Body)
 	logrus.
 		WithField("Request URL: ", req.URL).
@@ -151,7 +158,7 @@ func (c *RbClient) setSignatureHeaders(req *http.Request, secret *secretKey) (st
 		return "", nil
 	}
 
-	timestamp := time.Now().Unix() + SIGNATURE_LIFETIME
+	timestamp := c.now().Unix() + SIGNATURE_LIFETIME
 
 	signature, err := auth.PayloadSignature(payload, secret.apiSecret, timestamp)
 	if err != nil {
@@ -167,9 +174,8 @@ func (c *RbClient) setSignatureHeaders(req *http.Request, secret *secretKey) (st
 }
 
 // parsePayload parses the payload from a given http request.
+// Body fields are encoded by auth.CanonicalPayload.
 func (c *RbClient) parsePayload(req *http.Request) (map[string]string, error) {
-	var data map[string]json.RawMessage
-
 	rMethod := req.Method
 	if !(rMethod == http.MethodPost || rMethod == http.MethodPut || rMethod == http.MethodDelete) {
 		return nil, nil
@@ -181,13 +187,10 @@ func (c *RbClient) parsePayload(req *http.Request) (map[string]string, error) {
 	}
 
 	req.Body = io.NopCloser(bytes.NewReader(jsonData))
-	if err = json.Unmarshal(jsonData, &data); err != nil {
-		return nil, err
-	}
 
-	payloadData := map[string]string{}
-	for k, v := range data {
-		payloadData[k] = strings.Trim(string(v), "\"")
+	payloadData, err := auth.CanonicalPayload(jsonData)
+	if err != nil {
+		return nil, err
 	}
 
 	payloadData["method"] = rMethod
@@ -0,0 +1,551 @@
+package client
+
+import (
+	"encoding/json"
+	"rabbitx-client/model"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// DEFAULT_RECONCILE_INTERVAL is the time between two reconciliations of the account mirror with GetProfile.
+const DEFAULT_RECONCILE_INTERVAL = time.Minute
+
+// MAX_NOTIFICATIONS is the number of most recent notifications kept by the account mirror.
+const MAX_NOTIFICATIONS = 100
+
+// AccountMirror keeps a local copy of the profile merged from account@ channel updates.
+// Updates carry only changed fields, positions and orders, so they are merged field by
+// field into the last known state: a position is closed only by an explicit zero size
+// and an order is dropped once its status is final. The mirror is replaced by
+// GetProfile at start, periodically and on Reconcile.
+type AccountMirror struct {
+	client    *RbClient
+	interval  time.Duration
+	mu        sync.RWMutex
+	profile   model.ProfileData
+	synced    bool
+	nextId    int
+	listeners map[int]func(model.ProfileData)
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewAccountMirror creates a new AccountMirror of the client profile.
+// Non-positive interval means DEFAULT_RECONCILE_INTERVAL.
+func NewAccountMirror(client *RbClient, interval time.Duration) *AccountMirror {
+	if interval <= 0 {
+		interval = DEFAULT_RECONCILE_INTERVAL
+	}
+
+	return &AccountMirror{
+		client:    client,
+		interval:  interval,
+		listeners: make(map[int]func(model.ProfileData)),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start loads the profile and starts periodic reconciliation.
+func (m *AccountMirror) Start() error {
+	if err := m.Reconcile(); err != nil {
+		return err
+	}
+
+	go m.run()
+
+	return nil
+}
+
+// Stop stops periodic reconciliation.
+func (m *AccountMirror) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+// Reconcile replaces the mirror with the profile loaded over REST.
+// A profile older than the last merged update is ignored.
+func (m *AccountMirror) Reconcile() error {
+	profile, err := m.client.GetProfile()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if m.synced && isOlder(profile.LastUpdate, m.profile.LastUpdate) {
+		m.mu.Unlock()
+		return nil
+	}
+
+	notifications := m.profile.Notifications
+	m.profile = copyProfile(profile)
+	m.profile.Positions = openPositions(m.profile.Positions)
+	m.profile.Orders = activeOrders(m.profile.Orders)
+	if len(m.profile.Notifications) == 0 {
+		m.profile.Notifications = notifications
+	}
+	m.synced = true
+	snapshot := copyProfile(&m.profile)
+	m.mu.Unlock()
+
+	m.notify(snapshot)
+
+	return nil
+}
+
+// Apply merges a decoded account@ channel update into the mirror. Which fields of
+// positions and orders the update carries is inferred from non-zero values, so a
+// zero size does not close a position; use ApplyJSON for raw channel data.
+func (m *AccountMirror) Apply(update *model.ProfileData) {
+	if update == nil {
+		return
+	}
+
+	m.apply(update, presentFields(update.Positions), presentFields(update.Orders))
+}
+
+// ApplyJSON merges a raw account@ channel publication into the mirror.
+// Only fields present in the data are merged, e.g. "size":"0" closes a position.
+func (m *AccountMirror) ApplyJSON(data []byte) error {
+	var update model.ProfileData
+	if err := json.Unmarshal(data, &update); err != nil {
+		return err
+	}
+
+	var fields struct {
+		Positions []fieldSet `json:"positions"`
+		Orders    []fieldSet `json:"orders"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	m.apply(&update, fields.Positions, fields.Orders)
+
+	return nil
+}
+
+// apply merges the update given the fields carried by each of its positions and orders.
+func (m *AccountMirror) apply(update *model.ProfileData, positionFields, orderFields []fieldSet) {
+	m.mu.Lock()
+	if m.profile.ProfileID != 0 && update.ProfileID != 0 && update.ProfileID != m.profile.ProfileID {
+		m.mu.Unlock()
+		logrus.Warnf("Account mirror of profile %d ignored update of profile %d", m.profile.ProfileID, update.ProfileID)
+		return
+	}
+
+	mergeProfileCache(&m.profile.ProfileCache, &update.ProfileCache)
+	m.profile.Positions = mergePositions(m.profile.Positions, update.Positions, positionFields)
+	m.profile.Orders = mergeOrders(m.profile.Orders, update.Orders, orderFields)
+	m.profile.Notifications = append(m.profile.Notifications, update.Notifications...)
+	if n := len(m.profile.Notifications); n > MAX_NOTIFICATIONS {
+		m.profile.Notifications = append([]*model.ProfileNotification{}, m.profile.Notifications[n-MAX_NOTIFICATIONS:]...)
+	}
+	snapshot := copyProfile(&m.profile)
+	m.mu.Unlock()
+
+	m.notify(snapshot)
+}
+
+// Synced reports whether the mirror was loaded from REST at least once.
+func (m *AccountMirror) Synced() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.synced
+}
+
+// Snapshot returns a copy of the mirrored profile.
+func (m *AccountMirror) Snapshot() model.ProfileData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return copyProfile(&m.profile)
+}
+
+// Position returns the open position in the market.
+func (m *AccountMirror) Position(marketId string) (model.PositionData, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, position := range m.profile.Positions {
+		if position.MarketID == marketId {
+			return *position, true
+		}
+	}
+
+	return model.PositionData{}, false
+}
+
+// Orders returns the active orders in the market, all markets if marketId is empty.
+func (m *AccountMirror) Orders(marketId string) []model.OrderData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make([]model.OrderData, 0, len(m.profile.Orders))
+	for _, order := range m.profile.Orders {
+		if marketId == "" || order.MarketID == marketId {
+			res = append(res, *order)
+		}
+	}
+
+	return res
+}
+
+// OnChange registers a callback called with a snapshot after every change
+// and returns a function removing it. The callback must not block.
+func (m *AccountMirror) OnChange(fn func(profile model.ProfileData)) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextId
+	m.nextId++
+	m.listeners[id] = fn
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		delete(m.listeners, id)
+	}
+}
+
+// run reconciles periodically until stopped.
+func (m *AccountMirror) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Reconcile(); err != nil {
+				logrus.Warnf("Failed to reconcile account mirror: %s", err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// notify calls the change callbacks.
+func (m *AccountMirror) notify(snapshot model.ProfileData) {
+	m.mu.RLock()
+	listeners := make([]func(model.ProfileData), 0, len(m.listeners))
+	for _, fn := range m.listeners {
+		listeners = append(listeners, fn)
+	}
+	m.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(snapshot)
+	}
+}
+
+// mergeProfileCache overwrites fields of dst present in the update.
+func mergeProfileCache(dst, update *model.ProfileCache) {
+	if update.ProfileID != 0 {
+		dst.ProfileID = update.ProfileID
+	}
+	if update.ProfileType != nil {
+		dst.ProfileType = update.ProfileType
+	}
+	if update.Status != nil {
+		dst.Status = update.Status
+	}
+	if update.Wallet != nil {
+		dst.Wallet = update.Wallet
+	}
+	if update.LastUpdate != nil {
+		dst.LastUpdate = update.LastUpdate
+	}
+	if update.LastLiqCheck != nil {
+		dst.LastLiqCheck = update.LastLiqCheck
+	}
+	mergeDecimal(&dst.Balance, update.Balance)
+	mergeDecimal(&dst.AccountEquity, update.AccountEquity)
+	mergeDecimal(&dst.TotalPositionMargin, update.TotalPositionMargin)
+	mergeDecimal(&dst.TotalOrderMargin, update.TotalOrderMargin)
+	mergeDecimal(&dst.TotalNotional, update.TotalNotional)
+	mergeDecimal(&dst.AccountMargin, update.AccountMargin)
+	mergeDecimal(&dst.WithdrawbleBalance, update.WithdrawbleBalance)
+	mergeDecimal(&dst.CumUnrealizedPnl, update.CumUnrealizedPnl)
+	mergeDecimal(&dst.Health, update.Health)
+	mergeDecimal(&dst.AccountLeverage, update.AccountLeverage)
+	mergeDecimal(&dst.CumTradingVolume, update.CumTradingVolume)
+
+	if len(update.Leverage) > 0 {
+		leverage := make(map[string]decimal.Decimal, len(dst.Leverage)+len(update.Leverage))
+		for marketId, value := range dst.Leverage {
+			leverage[marketId] = value
+		}
+		for marketId, value := range update.Leverage {
+			leverage[marketId] = value
+		}
+		dst.Leverage = leverage
+	}
+}
+
+// fieldSet holds the JSON fields carried by an update.
+type fieldSet map[string]json.RawMessage
+
+// has reports whether the update carries the field.
+func (f fieldSet) has(name string) bool {
+	_, ok := f[name]
+	return ok
+}
+
+// presentFields infers the fields carried by decoded updates from their non-zero values.
+func presentFields[T any](items []*T) []fieldSet {
+	res := make([]fieldSet, len(items))
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+
+		var fields fieldSet
+		if err := json.Unmarshal(data, &fields); err != nil {
+			continue
+		}
+		for name, value := range fields {
+			switch string(value) {
+			case `null`, `""`, `"0"`, `0`, `false`:
+				delete(fields, name)
+			}
+		}
+		res[i] = fields
+	}
+
+	return res
+}
+
+// fieldsAt returns the fields of the i-th update, none if unknown.
+func fieldsAt(fields []fieldSet, i int) fieldSet {
+	if i < len(fields) {
+		return fields[i]
+	}
+
+	return nil
+}
+
+// mergePositions merges position updates by market, field by field.
+// A position is closed only by an update with an explicit zero size.
+func mergePositions(positions, updates []*model.PositionData, fields []fieldSet) []*model.PositionData {
+	if len(updates) == 0 {
+		return positions
+	}
+
+	res := make([]*model.PositionData, 0, len(positions)+len(updates))
+	byMarket := make(map[string]*model.PositionData, len(positions)+len(updates))
+	for _, position := range positions {
+		p := *position
+		res = append(res, &p)
+		byMarket[p.MarketID] = &p
+	}
+
+	closed := make(map[string]bool)
+	for i, update := range updates {
+		f := fieldsAt(fields, i)
+
+		dst, ok := byMarket[update.MarketID]
+		if !ok {
+			dst = &model.PositionData{MarketID: update.MarketID}
+			res = append(res, dst)
+			byMarket[update.MarketID] = dst
+		}
+		mergePosition(dst, update, f)
+
+		closed[update.MarketID] = f.has("size") && update.Size.IsZero()
+	}
+
+	open := make([]*model.PositionData, 0, len(res))
+	for _, position := range res {
+		if !closed[position.MarketID] {
+			open = append(open, position)
+		}
+	}
+
+	return open
+}
+
+// mergePosition overwrites fields of dst carried by the update.
+func mergePosition(dst, update *model.PositionData, fields fieldSet) {
+	if fields.has("id") {
+		dst.PositionID = update.PositionID
+	}
+	if fields.has("profile_id") {
+		dst.ProfileID = update.ProfileID
+	}
+	if fields.has("size") {
+		dst.Size = update.Size
+	}
+	if fields.has("side") {
+		dst.Side = update.Side
+	}
+	if fields.has("entry_price") {
+		dst.EntryPrice = update.EntryPrice
+	}
+	if fields.has("unrealized_pnl") {
+		dst.UnrealizedPnlFair = update.UnrealizedPnlFair
+	}
+	if fields.has("notional") {
+		dst.NotionalFair = update.NotionalFair
+	}
+	if fields.has("margin") {
+		dst.Margin = update.Margin
+	}
+	if fields.has("liquidation_price") {
+		dst.LiquidationPrice = update.LiquidationPrice
+	}
+	if fields.has("fair_price") {
+		dst.FairPrice = update.FairPrice
+	}
+}
+
+// mergeOrders merges order updates by ID, field by field. Orders whose status is final are dropped.
+func mergeOrders(orders, updates []*model.OrderData, fields []fieldSet) []*model.OrderData {
+	if len(updates) == 0 {
+		return orders
+	}
+
+	res := make([]*model.OrderData, 0, len(orders)+len(updates))
+	byId := make(map[string]*model.OrderData, len(orders)+len(updates))
+	for _, order := range orders {
+		o := *order
+		res = append(res, &o)
+		byId[o.OrderId] = &o
+	}
+
+	for i, update := range updates {
+		dst, ok := byId[update.OrderId]
+		if !ok {
+			dst = &model.OrderData{OrderId: update.OrderId}
+			res = append(res, dst)
+			byId[update.OrderId] = dst
+		}
+		mergeOrder(dst, update, fieldsAt(fields, i))
+	}
+
+	return activeOrders(res)
+}
+
+// mergeOrder overwrites fields of dst carried by the update.
+func mergeOrder(dst, update *model.OrderData, fields fieldSet) {
+	if fields.has("profile_id") {
+		dst.ProfileID = update.ProfileID
+	}
+	if fields.has("market_id") {
+		dst.MarketID = update.MarketID
+	}
+	if fields.has("order_type") {
+		dst.OrderType = update.OrderType
+	}
+	if fields.has("status") {
+		dst.Status = update.Status
+	}
+	if fields.has("price") {
+		dst.Price = update.Price
+	}
+	if fields.has("size") {
+		dst.Size = update.Size
+	}
+	if fields.has("initial_size") {
+		dst.InitialSize = update.InitialSize
+	}
+	if fields.has("total_filled_size") {
+		dst.TotalFilledSize = update.TotalFilledSize
+	}
+	if fields.has("side") {
+		dst.Side = update.Side
+	}
+	if fields.has("timestamp") {
+		dst.Timestamp = update.Timestamp
+	}
+	if fields.has("reason") {
+		dst.Reason = update.Reason
+	}
+	if fields.has("client_order_id") {
+		dst.ClientOrderId = update.ClientOrderId
+	}
+	if fields.has("trigger_price") {
+		dst.TriggerPrice = update.TriggerPrice
+	}
+	if fields.has("size_percent") {
+		dst.SizePercent = update.SizePercent
+	}
+	if fields.has("time_in_force") {
+		dst.TimeInForce = update.TimeInForce
+	}
+	if fields.has("created_at") {
+		dst.CreatedAt = update.CreatedAt
+	}
+	if fields.has("updated_at") {
+		dst.UpdatedAt = update.UpdatedAt
+	}
+}
+
+// openPositions returns positions of non-zero size.
+func openPositions(positions []*model.PositionData) []*model.PositionData {
+	res := make([]*model.PositionData, 0, len(positions))
+	for _, position := range positions {
+		if !position.Size.IsZero() {
+			res = append(res, position)
+		}
+	}
+
+	return res
+}
+
+// activeOrders returns orders which are not finished.
+func activeOrders(orders []*model.OrderData) []*model.OrderData {
+	res := make([]*model.OrderData, 0, len(orders))
+	for _, order := range orders {
+		switch order.Status {
+		case model.CLOSED, model.CANCELED, model.REJECTED:
+		default:
+			res = append(res, order)
+		}
+	}
+
+	return res
+}
+
+// isOlder reports whether timestamp a is before b, unknown timestamps are not older.
+func isOlder(a, b *int64) bool {
+	return a != nil && b != nil && *a < *b
+}
+
+// copyProfile returns a copy of the profile which shares no slices or maps with it.
+func copyProfile(profile *model.ProfileData) model.ProfileData {
+	res := *profile
+
+	if profile.Leverage != nil {
+		res.Leverage = make(map[string]decimal.Decimal, len(profile.Leverage))
+		for marketId, value := range profile.Leverage {
+			res.Leverage[marketId] = value
+		}
+	}
+
+	res.Positions = make([]*model.PositionData, 0, len(profile.Positions))
+	for _, position := range profile.Positions {
+		p := *position
+		res.Positions = append(res.Positions, &p)
+	}
+
+	res.Orders = make([]*model.OrderData, 0, len(profile.Orders))
+	for _, order := range profile.Orders {
+		o := *order
+		res.Orders = append(res.Orders, &o)
+	}
+
+	res.Notifications = make([]*model.ProfileNotification, 0, len(profile.Notifications))
+	for _, notification := range profile.Notifications {
+		n := *notification
+		res.Notifications = append(res.Notifications, &n)
+	}
+
+	return res
+}
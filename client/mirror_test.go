@@ -0,0 +1,65 @@
+package client
+
+import (
+	"rabbitx-client/model"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAccountMirrorMergesPartialUpdates(t *testing.T) {
+	m := NewAccountMirror(nil, 0)
+
+	updates := []string{
+		`{"id":1,"positions":[{"id":"p1","market_id":"BTC-USD","size":"0.5","side":"long","entry_price":"27000"}],
+			"orders":[{"id":"o1","market_id":"BTC-USD","status":"open","price":"26000","size":"0.1","side":"long"}]}`,
+		// Partial deltas carry only the changed fields.
+		`{"positions":[{"market_id":"BTC-USD","unrealized_pnl":"12.5"}],
+			"orders":[{"id":"o1","total_filled_size":"0.05"}]}`,
+	}
+	for _, update := range updates {
+		if err := m.ApplyJSON([]byte(update)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	position, ok := m.Position("BTC-USD")
+	if !ok {
+		t.Fatal("position dropped by a delta without size")
+	}
+	if !position.Size.Equal(decimal.RequireFromString("0.5")) || position.Side != model.LONG || position.PositionID != "p1" {
+		t.Errorf("position = %+v, want size 0.5 long p1", position)
+	}
+	if position.UnrealizedPnlFair == nil || !position.UnrealizedPnlFair.Equal(decimal.RequireFromString("12.5")) {
+		t.Errorf("unrealized pnl = %v, want 12.5", position.UnrealizedPnlFair)
+	}
+
+	orders := m.Orders("BTC-USD")
+	if len(orders) != 1 {
+		t.Fatalf("orders = %+v, want one", orders)
+	}
+	order := orders[0]
+	if order.Status != model.OPEN || order.Price == nil || !order.Price.Equal(decimal.RequireFromString("26000")) {
+		t.Errorf("order = %+v, want open at 26000", order)
+	}
+	if order.TotalFilledSize == nil || !order.TotalFilledSize.Equal(decimal.RequireFromString("0.05")) {
+		t.Errorf("filled size = %v, want 0.05", order.TotalFilledSize)
+	}
+
+	// A decoded update can not tell a missing size from zero, so it does not close.
+	m.Apply(&model.ProfileData{Positions: []*model.PositionData{{MarketID: "BTC-USD"}}})
+	if _, ok := m.Position("BTC-USD"); !ok {
+		t.Error("position closed by a decoded update without size")
+	}
+
+	closing := `{"positions":[{"market_id":"BTC-USD","size":"0"}],"orders":[{"id":"o1","status":"closed"}]}`
+	if err := m.ApplyJSON([]byte(closing)); err != nil {
+		t.Fatal(err)
+	}
+	if position, ok := m.Position("BTC-USD"); ok {
+		t.Errorf("position = %+v, want closed by explicit zero size", position)
+	}
+	if orders := m.Orders(""); len(orders) != 0 {
+		t.Errorf("orders = %+v, want the closed order dropped", orders)
+	}
+}
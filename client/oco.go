@@ -0,0 +1,520 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"rabbitx-client/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OCOLeg is one order of an OCO group.
+type OCOLeg struct {
+	OrderId   string `json:"order_id"`   // The order ID.
+	OrderType string `json:"order_type"` // The type of the order.
+	Status    string `json:"status"`     // The last seen status of the order.
+}
+
+// OCO group states.
+const (
+	// OCO_ACTIVE means no leg fired yet.
+	OCO_ACTIVE = "active"
+
+	// OCO_FIRING means a leg fired and the other legs are being canceled.
+	OCO_FIRING = "firing"
+
+	// OCO_CANCELING means the group was canceled and its legs are being canceled.
+	OCO_CANCELING = "canceling"
+)
+
+// OCOGroup is a set of orders in one market where a fill or trigger of one cancels the others.
+type OCOGroup struct {
+	Id           string    `json:"id"`                       // The ID of the group.
+	MarketId     string    `json:"market_id"`                // The market ID of the orders.
+	Legs         []*OCOLeg `json:"legs"`                     // The orders of the group.
+	State        string    `json:"state,omitempty"`          // The state of the group, OCO_ACTIVE if empty.
+	FiredOrderId string    `json:"fired_order_id,omitempty"` // The order ID of the leg which fired.
+}
+
+// OCOStore persists OCO groups, so legs are not orphaned on restart.
+type OCOStore interface {
+	Load() ([]*OCOGroup, error)
+	Save(groups []*OCOGroup) error
+}
+
+// FileOCOStore stores OCO groups as JSON in a file.
+type FileOCOStore struct {
+	Path string
+}
+
+// Load implements OCOStore. A missing file means no groups.
+func (s FileOCOStore) Load() ([]*OCOGroup, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*OCOGroup
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// Save implements OCOStore. The file is replaced atomically.
+func (s FileOCOStore) Save(groups []*OCOGroup) error {
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data)
+}
+
+// OCOManager maintains OCO groups of a client. Order updates come from
+// PublishOrderUpdate, e.g. fed from account@ channel, with REST polling as fallback.
+// When a leg fills, partially or completely, or a stop leg triggers,
+// the other legs of the group are canceled. The group is kept, and persisted,
+// in OCO_FIRING state and the cancels are retried on every poll until
+// all other legs are reported final; only then the group is dropped.
+type OCOManager struct {
+	client         *RbClient
+	store          OCOStore
+	pollInterval   time.Duration
+	updates        chan *model.OrderData
+	done           chan struct{}
+	removeListener func()
+	mu             sync.Mutex
+	saveMu         sync.Mutex
+	stopOnce       sync.Once
+	groups         map[string]*OCOGroup
+	nextId         int64
+}
+
+// NewOCOManager creates a new OCOManager persisting groups to store.
+// Non-positive pollInterval means DEFAULT_POLL_INTERVAL.
+func NewOCOManager(client *RbClient, store OCOStore, pollInterval time.Duration) *OCOManager {
+	if pollInterval <= 0 {
+		pollInterval = DEFAULT_POLL_INTERVAL
+	}
+
+	return &OCOManager{
+		client:       client,
+		store:        store,
+		pollInterval: pollInterval,
+		updates:      make(chan *model.OrderData, 1024),
+		done:         make(chan struct{}),
+		groups:       make(map[string]*OCOGroup),
+	}
+}
+
+// Start loads persisted groups, reconciles them over REST and starts processing updates.
+func (m *OCOManager) Start() error {
+	groups, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	for _, group := range groups {
+		if group.State == "" {
+			group.State = OCO_ACTIVE
+		}
+		m.groups[group.Id] = group
+	}
+	m.mu.Unlock()
+
+	m.removeListener = m.client.AddOrderListener(m)
+
+	// Orders may have filled while we were not running.
+	m.poll()
+
+	go m.run()
+
+	return nil
+}
+
+// Stop stops processing updates. Groups stay persisted. It is safe to call Stop more than once.
+func (m *OCOManager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+		if m.removeListener != nil {
+			m.removeListener()
+		}
+	})
+}
+
+// Place places all orders as one OCO group. All orders must be in the same market.
+// If any order fails, the placed ones are canceled.
+func (m *OCOManager) Place(requests ...*DecimalOrderCreateRequest) (*OCOGroup, error) {
+	if len(requests) < 2 {
+		return nil, errors.New("OCO group requires at least two orders")
+	}
+
+	marketId := requests[0].MarketId
+	for _, req := range requests {
+		if req.MarketId != marketId {
+			return nil, errors.New("OCO group orders must be in the same market")
+		}
+	}
+
+	legs := make([]*OCOLeg, 0, len(requests))
+	for _, req := range requests {
+		order, err := m.client.CreateOrderDecimal(req)
+		if err != nil {
+			for _, leg := range legs {
+				m.cancelLeg(marketId, *leg)
+			}
+			return nil, err
+		}
+
+		legs = append(legs, &OCOLeg{
+			OrderId:   order.OrderId,
+			OrderType: order.Type,
+			Status:    order.Status,
+		})
+	}
+
+	return m.add(marketId, legs)
+}
+
+// Group links already placed orders into an OCO group.
+func (m *OCOManager) Group(marketId string, orderIds ...string) (*OCOGroup, error) {
+	if len(orderIds) < 2 {
+		return nil, errors.New("OCO group requires at least two orders")
+	}
+
+	legs := make([]*OCOLeg, 0, len(orderIds))
+	for _, id := range orderIds {
+		order, err := m.client.GetOrder(marketId, id)
+		if err != nil {
+			return nil, err
+		}
+
+		legs = append(legs, &OCOLeg{
+			OrderId:   order.OrderId,
+			OrderType: order.OrderType,
+			Status:    order.Status,
+		})
+	}
+
+	return m.add(marketId, legs)
+}
+
+// Cancel cancels all remaining legs of the group. The group is dropped once
+// all legs are reported final, until then it is kept in OCO_CANCELING state
+// and failed cancels are retried on every poll.
+func (m *OCOManager) Cancel(groupId string) error {
+	m.mu.Lock()
+	group, ok := m.groups[groupId]
+	if ok && group.State == OCO_ACTIVE {
+		group.State = OCO_CANCELING
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown OCO group %s", groupId)
+	}
+
+	errs := []error{m.save()}
+	errs = append(errs, m.cancelPending(groupId))
+	errs = append(errs, m.dropSettled(groupId))
+
+	return errors.Join(errs...)
+}
+
+// Groups returns copies of all active groups.
+func (m *OCOManager) Groups() []OCOGroup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups := make([]OCOGroup, 0, len(m.groups))
+	for _, group := range m.groups {
+		groups = append(groups, copyGroup(group))
+	}
+
+	return groups
+}
+
+// OnOrderUpdate implements OrderListener.
+func (m *OCOManager) OnOrderUpdate(order *model.OrderData) {
+	select {
+	case m.updates <- order:
+	default:
+		// Updates are dropped when the queue is full, polling recovers the state.
+	}
+}
+
+// add registers a new group and persists it.
+func (m *OCOManager) add(marketId string, legs []*OCOLeg) (*OCOGroup, error) {
+	m.mu.Lock()
+	m.nextId++
+	group := &OCOGroup{
+		Id:       strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(m.nextId, 10),
+		MarketId: marketId,
+		Legs:     legs,
+		State:    OCO_ACTIVE,
+	}
+	m.groups[group.Id] = group
+	result := copyGroup(group)
+	m.mu.Unlock()
+
+	if err := m.save(); err != nil {
+		return &result, err
+	}
+
+	return &result, nil
+}
+
+// run processes order updates and polls until stopped.
+func (m *OCOManager) run() {
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case order := <-m.updates:
+			m.handleOrder(order)
+		case <-ticker.C:
+			m.poll()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// poll refreshes legs of all groups over REST and retries cancels of firing and canceling groups.
+func (m *OCOManager) poll() {
+	for _, group := range m.Groups() {
+		for _, leg := range group.Legs {
+			order, err := m.client.GetOrder(group.MarketId, leg.OrderId)
+			if err != nil {
+				logrus.Warnf("OCO failed to poll order %s: %s", leg.OrderId, err)
+				continue
+			}
+			m.handleOrder(order)
+		}
+
+		if err := m.cancelPending(group.Id); err != nil {
+			logrus.Warnf("OCO group %s still has orders to cancel, retrying on next poll: %s", group.Id, err)
+		}
+		if err := m.dropSettled(group.Id); err != nil {
+			logrus.Errorf("Failed to save OCO groups: %s", err)
+		}
+	}
+}
+
+// handleOrder applies an order update and cancels sibling legs if the order fired.
+func (m *OCOManager) handleOrder(order *model.OrderData) {
+	m.mu.Lock()
+	group, leg := m.findLeg(order.OrderId)
+	if group == nil {
+		m.mu.Unlock()
+		return
+	}
+
+	changed := leg.Status != order.Status
+	fired := group.State == OCO_ACTIVE && legFired(leg, order)
+	leg.Status = order.Status
+
+	switch {
+	case fired:
+		group.State = OCO_FIRING
+		group.FiredOrderId = leg.OrderId
+		changed = true
+	case group.State == OCO_ACTIVE && (order.Status == model.CANCELED || order.Status == model.REJECTED):
+		// Leg is gone without firing, the rest of the group stays linked.
+		group.Legs = removeLeg(group.Legs, leg)
+		if len(group.Legs) < 2 {
+			delete(m.groups, group.Id)
+		}
+	}
+	groupId := group.Id
+	m.mu.Unlock()
+
+	if changed {
+		// The firing state is persisted before the cancels, so a restart resumes them.
+		if err := m.save(); err != nil {
+			logrus.Errorf("Failed to save OCO groups: %s", err)
+		}
+	}
+
+	if fired {
+		logrus.Infof("OCO order %s fired, canceling other orders of group %s", order.OrderId, groupId)
+
+		if err := m.cancelPending(groupId); err != nil {
+			logrus.Warnf("OCO group %s still has orders to cancel, retrying on next poll: %s", groupId, err)
+		}
+	}
+
+	if err := m.dropSettled(groupId); err != nil {
+		logrus.Errorf("Failed to save OCO groups: %s", err)
+	}
+}
+
+// cancelPending cancels legs of a firing or canceling group which are not reported final yet.
+// A final status in the cancel response is recorded, otherwise it is awaited from updates.
+func (m *OCOManager) cancelPending(groupId string) error {
+	m.mu.Lock()
+	group, ok := m.groups[groupId]
+	if !ok || group.State == OCO_ACTIVE {
+		m.mu.Unlock()
+		return nil
+	}
+	marketId := group.MarketId
+	pending := pendingLegs(group)
+	m.mu.Unlock()
+
+	var errs []error
+	for _, leg := range pending {
+		status, err := m.cancelLeg(marketId, leg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if isFinal(status) {
+			m.mu.Lock()
+			if _, l := m.findLeg(leg.OrderId); l != nil {
+				l.Status = status
+			}
+			m.mu.Unlock()
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// dropSettled drops a firing or canceling group once all its legs to cancel are reported final.
+func (m *OCOManager) dropSettled(groupId string) error {
+	m.mu.Lock()
+	group, ok := m.groups[groupId]
+	settled := ok && group.State != OCO_ACTIVE && len(pendingLegs(group)) == 0
+	if settled {
+		delete(m.groups, groupId)
+	}
+	m.mu.Unlock()
+
+	if !settled {
+		return nil
+	}
+
+	logrus.Infof("OCO group %s closed", groupId)
+
+	return m.save()
+}
+
+// findLeg returns the group and leg of the order. Caller must hold mu.
+func (m *OCOManager) findLeg(orderId string) (*OCOGroup, *OCOLeg) {
+	for _, group := range m.groups {
+		for _, leg := range group.Legs {
+			if leg.OrderId == orderId {
+				return group, leg
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// cancelLeg cancels a leg order unless it is already final.
+// It returns the status reported by the cancel response.
+func (m *OCOManager) cancelLeg(marketId string, leg OCOLeg) (string, error) {
+	if isFinal(leg.Status) {
+		return leg.Status, nil
+	}
+
+	res, err := m.client.CancelOrder(&OrderCancelRequest{
+		OrderId:  leg.OrderId,
+		MarketId: marketId,
+	})
+	if err != nil {
+		logrus.Errorf("OCO failed to cancel order %s: %s", leg.OrderId, err)
+		return "", err
+	}
+
+	return res.Status, nil
+}
+
+// save persists the current groups. Saves are serialized and each one
+// snapshots the groups, so a later save never writes older state.
+func (m *OCOManager) save() error {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	m.mu.Lock()
+	groups := make([]*OCOGroup, 0, len(m.groups))
+	for _, group := range m.groups {
+		g := copyGroup(group)
+		groups = append(groups, &g)
+	}
+	m.mu.Unlock()
+
+	return m.store.Save(groups)
+}
+
+// pendingLegs returns copies of the legs of the group which are to be canceled
+// and are not reported final yet. Caller must hold mu.
+func pendingLegs(group *OCOGroup) []OCOLeg {
+	var res []OCOLeg
+	for _, leg := range group.Legs {
+		if leg.OrderId != group.FiredOrderId && !isFinal(leg.Status) {
+			res = append(res, *leg)
+		}
+	}
+
+	return res
+}
+
+// legFired reports whether the update means the leg filled or its stop triggered.
+func legFired(leg *OCOLeg, order *model.OrderData) bool {
+	if order.Status == model.CLOSED || filledSize(order).IsPositive() {
+		return true
+	}
+
+	// Stop orders rest as placed until triggered.
+	return isStopOrder(leg.OrderType) && leg.Status == model.PLACED && order.Status == model.OPEN
+}
+
+// isStopOrder reports whether the order type rests until a trigger price is reached.
+func isStopOrder(orderType string) bool {
+	switch orderType {
+	case model.STOP_LOSS, model.TAKE_PROFIT, model.STOP_LIMIT, model.STOP_MARKET, model.STOP_LOSS_LIMIT, model.TAKE_PROFIT_LIMIT:
+		return true
+	}
+
+	return false
+}
+
+// removeLeg returns legs without the given leg.
+func removeLeg(legs []*OCOLeg, leg *OCOLeg) []*OCOLeg {
+	res := make([]*OCOLeg, 0, len(legs))
+	for _, l := range legs {
+		if l != leg {
+			res = append(res, l)
+		}
+	}
+
+	return res
+}
+
+// copyGroup returns a deep copy of the group.
+func copyGroup(group *OCOGroup) OCOGroup {
+	res := *group
+	res.Legs = make([]*OCOLeg, 0, len(group.Legs))
+	for _, leg := range group.Legs {
+		l := *leg
+		res.Legs = append(res.Legs, &l)
+	}
+
+	return res
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"path/filepath"
+	"rabbitx-client/model"
+	"sync"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// memOCOStore keeps the last saved groups in memory.
+type memOCOStore struct {
+	mu     sync.Mutex
+	groups []*OCOGroup
+}
+
+// Load implements OCOStore.
+func (s *memOCOStore) Load() ([]*OCOGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.groups, nil
+}
+
+// Save implements OCOStore.
+func (s *memOCOStore) Save(groups []*OCOGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups = groups
+	return nil
+}
+
+// placeTestOCO places a buy and a sell limit order as one group.
+func placeTestOCO(t *testing.T, m *OCOManager) *OCOGroup {
+	t.Helper()
+
+	size := decimal.RequireFromString("0.001")
+	buy, err := Limit("BTC-USD", model.LONG, decimal.RequireFromString("26000"), size).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sell, err := Limit("BTC-USD", model.SHORT, decimal.RequireFromString("28000"), size).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := m.Place(buy, sell)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return group
+}
+
+func TestOCOFiringRetriesCancel(t *testing.T) {
+	c, ex := newTestExchangeClient(t)
+	store := &memOCOStore{}
+	m := NewOCOManager(c, store, 0)
+	group := placeTestOCO(t, m)
+
+	buyId, sellId := group.Legs[0].OrderId, group.Legs[1].OrderId
+	ex.fill(buyId, decimal.RequireFromString("0.0005"))
+	ex.mu.Lock()
+	ex.failCancels = 1
+	ex.mu.Unlock()
+
+	filled := ex.order(buyId)
+	m.handleOrder(&filled)
+
+	groups := m.Groups()
+	if len(groups) != 1 || groups[0].State != OCO_FIRING || groups[0].FiredOrderId != buyId {
+		t.Fatalf("groups after failed cancel = %+v, want one firing group", groups)
+	}
+	if saved, _ := store.Load(); len(saved) != 1 || saved[0].State != OCO_FIRING {
+		t.Fatalf("saved groups = %+v, want the firing group", saved)
+	}
+
+	m.poll()
+
+	if groups := m.Groups(); len(groups) != 0 {
+		t.Fatalf("groups after retried cancel = %+v, want none", groups)
+	}
+	if saved, _ := store.Load(); len(saved) != 0 {
+		t.Errorf("saved groups = %+v, want none", saved)
+	}
+	if status := ex.order(sellId).Status; status != model.CANCELED {
+		t.Errorf("sibling status = %s, want %s", status, model.CANCELED)
+	}
+	if status := ex.order(buyId).Status; status != model.OPEN {
+		t.Errorf("fired leg status = %s, want it left %s", status, model.OPEN)
+	}
+}
+
+func TestOCOCancelKeepsGroupUntilConfirmed(t *testing.T) {
+	c, ex := newTestExchangeClient(t)
+	m := NewOCOManager(c, &memOCOStore{}, 0)
+	group := placeTestOCO(t, m)
+
+	ex.mu.Lock()
+	ex.failCancels = 1
+	ex.mu.Unlock()
+
+	if err := m.Cancel(group.Id); err == nil {
+		t.Fatal("Cancel() with a failed leg cancel: expected error")
+	}
+	if groups := m.Groups(); len(groups) != 1 || groups[0].State != OCO_CANCELING {
+		t.Fatalf("groups = %+v, want one canceling group", groups)
+	}
+
+	m.poll()
+
+	if groups := m.Groups(); len(groups) != 0 {
+		t.Errorf("groups after retried cancel = %+v, want none", groups)
+	}
+}
+
+func TestOCOStopTwice(t *testing.T) {
+	c, _ := newTestExchangeClient(t)
+	m := NewOCOManager(c, &memOCOStore{}, 0)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Stop()
+	m.Stop()
+}
+
+func TestFileOCOStoreConcurrentSave(t *testing.T) {
+	store := FileOCOStore{Path: filepath.Join(t.TempDir(), "oco.json")}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.Save([]*OCOGroup{{Id: "1", MarketId: "BTC-USD", State: OCO_ACTIVE}})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Id != "1" {
+		t.Errorf("Load() = %+v, want the saved group", groups)
+	}
+
+	if matches, _ := filepath.Glob(store.Path + ".*.tmp"); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+}
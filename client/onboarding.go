@@ -8,7 +8,6 @@ import (
 	"rabbitx-client/auth"
 	"rabbitx-client/model"
 	"strconv"
-	"time"
 )
 
 // Onboarding is a method that creates a new user on the exchange or returns new secrets if the user already exists.
@@ -17,6 +16,7 @@ import (
 // The method returns a pointer to an OnboardMarketMakerResult object and an error object.
 // If the private key is nil, the method returns an error.
 // If the onboarding signature cannot be generated, the method returns an error.
+// If the wallet or signature fail request validation, the method returns ValidationErrors.
 // If the post request to the PATH_ONBOARDING endpoint fails, the method returns an error.
 // If the response body cannot be unmarshalled into a Response object, the method returns an error.
 // If the response indicates a failure, the method returns an error.
@@ -25,7 +25,7 @@ func (c *RbClient) Onboarding(wallet string, privateKey *ecdsa.PrivateKey) (*mod
 		return nil, fmt.Errorf("private key required for onboarding")
 	}
 
-	timestamp := time.Now().Unix() + SIGNATURE_LIFETIME
+	timestamp := c.now().Unix() + SIGNATURE_LIFETIME
 
 	signature, err := auth.OnboardingSiganture(privateKey, timestamp)
 	if err != nil {
@@ -37,11 +37,16 @@ func (c *RbClient) Onboarding(wallet string, privateKey *ecdsa.PrivateKey) (*mod
 		API_SECRET_TIMESTAMP_HEADER: strconv.FormatInt(timestamp, 10),
 	}
 
-	respBody, err := c.post(PATH_ONBOARDING, OnboardingRequest{
+	request := OnboardingRequest{
 		IsClient:  false,
 		Wallet:    wallet,
 		Signature: signature,
-	}, headers, nil)
+	}
+	if err := Validate(request); err != nil {
+		return nil, err
+	}
+
+	respBody, err := c.post(PATH_ONBOARDING, request, headers, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -3,14 +3,96 @@ package client
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"rabbitx-client/model"
-	"reflect"
 )
 
 // CreateOrder is a method that creates a new order on the exchange.
 // This method requires an OrderCreateRequest object as input.
+// The order is normalised once in decimal and sent as CreateOrderDecimal sends it,
+// the normalised price, size and trigger price are written back to the request.
 // The method returns a pointer to an OrderCreateResponse object and an error object.
 func (c *RbClient) CreateOrder(data *OrderCreateRequest) (*OrderCreateResponse, error) {
+	req := data.Decimal()
+	if err := c.markets.NormalizeOrder(req); err != nil {
+		return nil, err
+	}
+
+	data.Price = floatFromDecimal(req.Price)
+	data.Size = floatFromDecimal(req.Size)
+	data.TriggerPrice = floatFromDecimal(req.TriggerPrice)
+
+	return c.createOrder(req)
+}
+
+// CreateOrderDecimal is the same as CreateOrder but accepts decimal values,
+// which are sent to the exchange without float conversion.
+// The request is normalised in place to the market tick and minimum order, see MarketRegistry.
+func (c *RbClient) CreateOrderDecimal(data *DecimalOrderCreateRequest) (*OrderCreateResponse, error) {
+	if err := c.markets.NormalizeOrder(data); err != nil {
+		return nil, err
+	}
+
+	return c.createOrder(data)
+}
+
+// createOrder sends a normalised order and registers its client order ID.
+func (c *RbClient) createOrder(data *DecimalOrderCreateRequest) (*OrderCreateResponse, error) {
+	if err := c.checkClientOrderId(data.ClientOrderId); err != nil {
+		return nil, err
+	}
+
+	order, err := c.sendOrder(PATH_ORDERS, data, c.post)
+	if err != nil {
+		return nil, err
+	}
+
+	c.registerClientOrderId(data.ClientOrderId, data.MarketId, order.OrderId)
+
+	return order, nil
+}
+
+// AmendOrder is a method that amends an existing order on the exchange.
+// This method requires an OrderAmendRequest object as input.
+// The order is normalised once in decimal and sent like in AmendOrderDecimal, normalised values are written back to the request.
+// The method returns a pointer to an OrderCreateResponse object describing the amended order and an error object.
+func (c *RbClient) AmendOrder(data *OrderAmendRequest) (*OrderCreateResponse, error) {
+	req := data.Decimal()
+	if err := c.markets.NormalizeAmend(req); err != nil {
+		return nil, err
+	}
+
+	data.Price = floatFromDecimal(req.Price)
+	data.Size = floatFromDecimal(req.Size)
+	data.TriggerPrice = floatFromDecimal(req.TriggerPrice)
+
+	return c.sendOrder(PATH_ORDERS, req, c.put)
+}
+
+// AmendOrderDecimal is the same as AmendOrder but accepts decimal values.
+// The request is normalised in place like in CreateOrderDecimal.
+func (c *RbClient) AmendOrderDecimal(data *DecimalOrderAmendRequest) (*OrderCreateResponse, error) {
+	if err := c.markets.NormalizeAmend(data); err != nil {
+		return nil, err
+	}
+
+	return c.sendOrder(PATH_ORDERS, data, c.put)
+}
+
+// sendOrder checks the mainnet guard, validates, signs and sends an order request with the given method and decodes the order from the response.
+func (c *RbClient) sendOrder(
+	path string,
+	data interface{},
+	send func(string, interface{}, map[string]string, *secretKey) ([]byte, error),
+) (*OrderCreateResponse, error) {
+	if err := c.checkTradingAllowed(); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(data); err != nil {
+		return nil, err
+	}
+
 	apiKey, apiSecret, _, err := c.GetSecrets()
 	if err != nil {
 		return nil, err
@@ -20,7 +102,7 @@ func (c *RbClient) CreateOrder(data *OrderCreateRequest) (*OrderCreateResponse,
 		API_KEY_HEADER: apiKey,
 	}
 
-	respBody, err := c.post(PATH_ORDERS, data, headers, &secretKey{
+	respBody, err := send(path, data, headers, &secretKey{
 		apiKey:    apiKey,
 		apiSecret: apiSecret,
 	})
@@ -38,13 +120,32 @@ func (c *RbClient) CreateOrder(data *OrderCreateRequest) (*OrderCreateResponse,
 		return nil, errors.New(resp.Error)
 	}
 
+	if len(resp.Result) <= 0 {
+		return nil, errors.New("unexpected response: no result data")
+	}
+
 	return resp.Result[0], nil
 }
 
 // CancelOrder is a method that cancels an existing order on the exchange.
 // This method requires an OrderCancelRequest object as input.
+// If only the client order ID is set, the order ID is resolved with the client order registry.
 // The method returns a pointer to an OrderCancelResponse object and an error object.
 func (c *RbClient) CancelOrder(data *OrderCancelRequest) (*OrderCancelResponse, error) {
+	if data.OrderId == "" && data.ClientOrderId != "" {
+		if registry := c.clientOrderRegistry(); registry != nil {
+			if entry, ok := registry.Lookup(data.ClientOrderId); ok {
+				resolved := *data
+				resolved.OrderId = entry.OrderId
+				data = &resolved
+			}
+		}
+	}
+
+	if err := Validate(data); err != nil {
+		return nil, err
+	}
+
 	apiKey, apiSecret, _, err := c.GetSecrets()
 	if err != nil {
 		return nil, err
@@ -75,8 +176,93 @@ func (c *RbClient) CancelOrder(data *OrderCancelRequest) (*OrderCancelResponse,
 	return resp.Result[0], nil
 }
 
+// CancelAllOrders is a method that cancels all open orders of the profile in every market.
+// The method returns an error object.
+func (c *RbClient) CancelAllOrders() error {
+	apiKey, apiSecret, _, err := c.GetSecrets()
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		API_KEY_HEADER: apiKey,
+	}
+
+	respBody, err := c.delete(PATH_ORDERS_CANCEL_ALL, &OrderCancelAllRequest{}, headers, &secretKey{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp Response[json.RawMessage]
+
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// CancelMarketOrders is a method that cancels all resting orders of the profile in one market.
+// It returns the number of canceled orders and the first error, canceling continues after errors.
+func (c *RbClient) CancelMarketOrders(marketId string) (int, error) {
+	return c.cancelMarketOrders(marketId, func(order *model.OrderData) bool {
+		return true
+	})
+}
+
+// CancelTaggedOrders is a method that cancels the resting orders of the profile in one market
+// whose client order ID carries the tag, e.g. those of one strategy from any session.
+// It returns the number of canceled orders and the first error, canceling continues after errors.
+func (c *RbClient) CancelTaggedOrders(marketId, tag string) (int, error) {
+	return c.cancelMarketOrders(marketId, func(order *model.OrderData) bool {
+		return order.ClientOrderId != nil && HasClientOrderTag(*order.ClientOrderId, tag)
+	})
+}
+
+// cancelMarketOrders cancels the resting orders of the market accepted by match.
+func (c *RbClient) cancelMarketOrders(marketId string, match func(order *model.OrderData) bool) (int, error) {
+	orders, err := c.ListOrders(&OrderListRequest{
+		MarketId: marketId,
+		Status:   []string{model.OPEN, model.PLACED},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var firstErr error
+	canceled := 0
+	for i := range orders {
+		order := &orders[i]
+		if (order.Status != model.OPEN && order.Status != model.PLACED) || !match(order) {
+			continue
+		}
+
+		_, err := c.CancelOrder(&OrderCancelRequest{
+			OrderId:  order.OrderId,
+			MarketId: marketId,
+		})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		canceled++
+	}
+
+	return canceled, firstErr
+}
+
 // ListOrders is a method that lists all orders on the exchange.
 // This method requires an OrderListRequest object as input.
+// Client order IDs of listed orders are recorded in the client order registry, if set.
 // The method returns a slice of OrderData objects and an error object.
 func (c *RbClient) ListOrders(data *OrderListRequest) ([]model.OrderData, error) {
 	apiKey, _, _, err := c.GetSecrets()
@@ -88,9 +274,7 @@ func (c *RbClient) ListOrders(data *OrderListRequest) ([]model.OrderData, error)
 		API_KEY_HEADER: apiKey,
 	}
 
-	queryParams := makeQueryParams(reflect.ValueOf(*data))
-
-	respBody, err := c.get(PATH_ORDERS, queryParams, headers)
+	respBody, err := c.get(PATH_ORDERS, data, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -105,5 +289,30 @@ func (c *RbClient) ListOrders(data *OrderListRequest) ([]model.OrderData, error)
 		return nil, errors.New(resp.Error)
 	}
 
+	// Learn client order IDs of orders placed by other sessions and statuses of known ones.
+	for i := range resp.Result {
+		c.updateClientOrder(&resp.Result[i])
+	}
+
 	return resp.Result, nil
 }
+
+// GetOrder is a method that retrieves a single order by its ID.
+// The method returns an error if the order is not found.
+func (c *RbClient) GetOrder(marketId, orderId string) (*model.OrderData, error) {
+	orders, err := c.ListOrders(&OrderListRequest{
+		MarketId: marketId,
+		OrderId:  orderId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		if orders[i].OrderId == orderId {
+			return &orders[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("order %s not found", orderId)
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/shopspring/decimal"
+)
+
+// SnapToTick rounds value to the nearest multiple of tick.
+// Halfway values are rounded away from zero. Non-positive tick returns value as is.
+func SnapToTick(value, tick decimal.Decimal) decimal.Decimal {
+	if !tick.IsPositive() {
+		return value
+	}
+
+	return value.Div(tick).Round(0).Mul(tick)
+}
+
+// FloorToTick rounds value towards zero to a multiple of tick.
+// Non-positive tick returns value as is.
+func FloorToTick(value, tick decimal.Decimal) decimal.Decimal {
+	if !tick.IsPositive() {
+		return value
+	}
+
+	return value.Div(tick).Truncate(0).Mul(tick)
+}
+
+// snapPtr applies SnapToTick to an optional value.
+func snapPtr(value *decimal.Decimal, tick decimal.Decimal) *decimal.Decimal {
+	if value == nil {
+		return nil
+	}
+
+	snapped := SnapToTick(*value, tick)
+	return &snapped
+}
+
+// decimalNumber converts an optional decimal into a JSON number literal.
+func decimalNumber(value *decimal.Decimal) *json.Number {
+	if value == nil {
+		return nil
+	}
+
+	n := json.Number(value.String())
+	return &n
+}
+
+// decimalFromFloat converts an optional float into a decimal with the shortest representation.
+func decimalFromFloat(value *float64) *decimal.Decimal {
+	if value == nil {
+		return nil
+	}
+
+	d := decimal.NewFromFloat(*value)
+	return &d
+}
+
+// floatFromDecimal converts an optional decimal into the nearest float.
+func floatFromDecimal(value *decimal.Decimal) *float64 {
+	if value == nil {
+		return nil
+	}
+
+	f := value.InexactFloat64()
+	return &f
+}
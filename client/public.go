@@ -0,0 +1,20 @@
+package client
+
+import "errors"
+
+// ErrNoCredentials is returned by private methods of a client without credentials.
+var ErrNoCredentials = errors.New("client has no credentials, only public endpoints are available")
+
+// NewPublicClient creates a client of the environment without credentials.
+// Public endpoints such as GetMarkets and GetOrderbook work, private ones return ErrNoCredentials.
+func NewPublicClient(env Environment) *RbClient {
+	return NewRbClientForEnvironment(env, &Credentials{})
+}
+
+// HasCredentials reports whether the client can sign requests to private endpoints.
+func (c *RbClient) HasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.privateKey != nil || (c.apiSecret != nil && c.apiSecret.Key != "")
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"rabbitx-client/model"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DEFAULT_MARKETS_TTL is the period after which cached market data is reloaded.
+const DEFAULT_MARKETS_TTL = 5 * time.Minute
+
+// ErrMarketsUnavailable is returned when a market is not cached and the market registry
+// can not load it, orders of the market can not be normalised and are not sent.
+var ErrMarketsUnavailable = errors.New("market registry could not load markets")
+
+// MarketRegistry caches market metadata and normalises orders to market rules:
+// prices are snapped to MinTick, sizes to MinOrder steps.
+// Data is reloaded over REST when older than ttl and can be
+// updated in between from market: channel publications with Update.
+type MarketRegistry struct {
+	client   *RbClient
+	ttl      time.Duration
+	mu       sync.RWMutex
+	markets  map[string]*model.MarketData
+	loadedAt time.Time
+	inflight *refreshCall
+}
+
+// refreshCall is a reload of markets shared by concurrent Refresh callers.
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewMarketRegistry creates a new MarketRegistry which loads markets with the given client.
+// Non-positive ttl means DEFAULT_MARKETS_TTL.
+func NewMarketRegistry(client *RbClient, ttl time.Duration) *MarketRegistry {
+	if ttl <= 0 {
+		ttl = DEFAULT_MARKETS_TTL
+	}
+
+	return &MarketRegistry{
+		client:  client,
+		ttl:     ttl,
+		markets: make(map[string]*model.MarketData),
+	}
+}
+
+// Refresh reloads all markets from the exchange.
+// Concurrent callers share one request and its result.
+func (r *MarketRegistry) Refresh() error {
+	r.mu.Lock()
+	if call := r.inflight; call != nil {
+		r.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+
+	call := &refreshCall{done: make(chan struct{})}
+	r.inflight = call
+	r.mu.Unlock()
+
+	call.err = r.load()
+
+	r.mu.Lock()
+	r.inflight = nil
+	r.mu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// load requests all markets and replaces the cache.
+func (r *MarketRegistry) load() error {
+	markets, err := r.client.GetMarkets()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.markets = make(map[string]*model.MarketData, len(markets))
+	for _, market := range markets {
+		r.markets[market.MarketID] = market
+	}
+	r.loadedAt = r.client.localNow()
+
+	return nil
+}
+
+// Market returns a copy of cached market data, reloading the cache if it is stale.
+func (r *MarketRegistry) Market(marketId string) (model.MarketData, error) {
+	r.mu.RLock()
+	stale := r.client.localNow().Sub(r.loadedAt) > r.ttl
+	market, ok := r.markets[marketId]
+	r.mu.RUnlock()
+
+	if stale || !ok {
+		if err := r.Refresh(); err != nil {
+			if ok {
+				// Serve stale data rather than fail the order.
+				return *market, nil
+			}
+			return model.MarketData{}, fmt.Errorf("%w for %s: %s", ErrMarketsUnavailable, marketId, err)
+		}
+
+		r.mu.RLock()
+		market, ok = r.markets[marketId]
+		r.mu.RUnlock()
+	}
+
+	if !ok {
+		return model.MarketData{}, fmt.Errorf("unknown market %s", marketId)
+	}
+
+	return *market, nil
+}
+
+// Update merges a market: channel publication into the cache.
+// Only fields present in the update overwrite cached values.
+func (r *MarketRegistry) Update(update *model.MarketData) {
+	if update == nil || update.MarketID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	market, ok := r.markets[update.MarketID]
+	if !ok {
+		// Partial updates are not enough to trade on, wait for the next Refresh.
+		return
+	}
+
+	merged := *market
+	mergeDecimal(&merged.MinTick, update.MinTick)
+	mergeDecimal(&merged.MinOrder, update.MinOrder)
+	mergeDecimal(&merged.MinInitialMargin, update.MinInitialMargin)
+	mergeDecimal(&merged.ForcedMargin, update.ForcedMargin)
+	mergeDecimal(&merged.LiquidationMargin, update.LiquidationMargin)
+	mergeDecimal(&merged.BestBid, update.BestBid)
+	mergeDecimal(&merged.BestAsk, update.BestAsk)
+	mergeDecimal(&merged.MarketPrice, update.MarketPrice)
+	mergeDecimal(&merged.IndexPrice, update.IndexPrice)
+	mergeDecimal(&merged.LastTradePrice, update.LastTradePrice)
+	mergeDecimal(&merged.FairPrice, update.FairPrice)
+	if update.Status != nil {
+		merged.Status = update.Status
+	}
+	if update.LastUpdateTime != 0 {
+		merged.LastUpdateTime = update.LastUpdateTime
+	}
+	if update.LastUpdateSequence != 0 {
+		merged.LastUpdateSequence = update.LastUpdateSequence
+	}
+
+	r.markets[update.MarketID] = &merged
+}
+
+// NormalizeOrder snaps price and trigger price of the order to market tick
+// and rounds size down to a multiple of the minimum order.
+// It returns an error if the market is not active or the size is below the minimum order.
+func (r *MarketRegistry) NormalizeOrder(req *DecimalOrderCreateRequest) error {
+	market, err := r.tradableMarket(req.MarketId)
+	if err != nil {
+		return err
+	}
+
+	req.Price = snapPtr(req.Price, tickOf(market.MinTick))
+	req.TriggerPrice = snapPtr(req.TriggerPrice, tickOf(market.MinTick))
+	req.Size, err = normalizeSize(req.Size, market)
+
+	return err
+}
+
+// NormalizeAmend applies the same rules as NormalizeOrder to an amend request.
+func (r *MarketRegistry) NormalizeAmend(req *DecimalOrderAmendRequest) error {
+	market, err := r.tradableMarket(req.MarketId)
+	if err != nil {
+		return err
+	}
+
+	req.Price = snapPtr(req.Price, tickOf(market.MinTick))
+	req.TriggerPrice = snapPtr(req.TriggerPrice, tickOf(market.MinTick))
+	req.Size, err = normalizeSize(req.Size, market)
+
+	return err
+}
+
+// tradableMarket returns market data if the market accepts orders.
+func (r *MarketRegistry) tradableMarket(marketId string) (model.MarketData, error) {
+	market, err := r.Market(marketId)
+	if err != nil {
+		return market, err
+	}
+
+	if market.Status != nil && *market.Status != model.MARKET_STATUS_ACTIVE {
+		return market, fmt.Errorf("market %s is %s", marketId, *market.Status)
+	}
+
+	return market, nil
+}
+
+// normalizeSize rounds size down to the minimum order step and checks the minimum.
+func normalizeSize(size *decimal.Decimal, market model.MarketData) (*decimal.Decimal, error) {
+	if size == nil {
+		return nil, nil
+	}
+
+	step := tickOf(market.MinOrder)
+	normalized := FloorToTick(*size, step)
+	if step.IsPositive() && normalized.LessThan(step) {
+		return nil, fmt.Errorf("size %s is below minimum order %s for %s", size, step, market.MarketID)
+	}
+
+	return &normalized, nil
+}
+
+// tickOf returns tick value or zero if it is unknown.
+func tickOf(tick *decimal.Decimal) decimal.Decimal {
+	if tick == nil {
+		return decimal.Zero
+	}
+	return *tick
+}
+
+// mergeDecimal overwrites dst with src if src is set.
+func mergeDecimal(dst **decimal.Decimal, src *decimal.Decimal) {
+	if src != nil {
+		*dst = src
+	}
+}
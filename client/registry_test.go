@@ -0,0 +1,152 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const testMarketsResponse = `{"success":true,"error":"","result":[{"id":"BTC-USD","status":"active","min_tick":"0.5","min_order":"0.001"}]}`
+
+// newTestMarketsClient returns a public client of a server answering GET /markets
+// after release is closed, counting the requests.
+func newTestMarketsClient(t *testing.T, release <-chan struct{}, requests *atomic.Int32) *RbClient {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PATH_MARKETS {
+			http.NotFound(w, r)
+			return
+		}
+
+		requests.Add(1)
+		<-release
+		w.Write([]byte(testMarketsResponse))
+	}))
+	t.Cleanup(server.Close)
+
+	return NewPublicClient(Environment{Name: ENV_CUSTOM, ApiUrl: server.URL})
+}
+
+func TestMarketRegistryRefreshSingleFlight(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int32
+	c := newTestMarketsClient(t, release, &requests)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Markets().Refresh()
+		}()
+	}
+
+	// Let every caller reach Refresh before the request completes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("concurrent refreshes sent %d requests, want 1", n)
+	}
+
+	if _, err := c.Markets().Market("BTC-USD"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later refresh is not served from the finished call.
+	if err := c.Markets().Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("refresh after completion sent %d requests in total, want 2", n)
+	}
+}
+
+func TestNormalizeFloatOrder(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	var requests atomic.Int32
+	c := newTestMarketsClient(t, release, &requests)
+
+	price := 27000.7
+	size := 0.0025
+	req := (&OrderCreateRequest{MarketId: "BTC-USD", Type: "limit", Side: "long", Price: &price, Size: &size}).Decimal()
+	if err := c.Markets().NormalizeOrder(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := decimal.RequireFromString("27000.5"); !req.Price.Equal(want) {
+		t.Errorf("price = %s, want %s", req.Price, want)
+	}
+	if want := decimal.RequireFromString("0.002"); !req.Size.Equal(want) {
+		t.Errorf("size = %s, want %s", req.Size, want)
+	}
+
+	tiny := 0.0005
+	amend := (&OrderAmendRequest{OrderId: "1", MarketId: "BTC-USD", Size: &tiny}).Decimal()
+	if err := c.Markets().NormalizeAmend(amend); err == nil {
+		t.Error("amend below minimum order: expected error")
+	}
+}
+
+func TestCreateOrderNormalisesOnce(t *testing.T) {
+	c, ex := newTestExchangeClient(t)
+
+	price := 27000.7
+	size := 0.0025
+	req := &OrderCreateRequest{MarketId: "BTC-USD", Type: "limit", Side: "long", Price: &price, Size: &size}
+	order, err := c.CreateOrder(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *req.Price != 27000.5 || *req.Size != 0.002 {
+		t.Errorf("request = %v at %v, want the normalised 0.002 at 27000.5", *req.Size, *req.Price)
+	}
+	sent := ex.order(order.OrderId)
+	if !sent.Price.Equal(decimal.RequireFromString("27000.5")) || !sent.Size.Equal(decimal.RequireFromString("0.002")) {
+		t.Errorf("sent order = %s at %s, want 0.002 at 27000.5", sent.Size, sent.Price)
+	}
+}
+
+func TestOrderWithoutMarkets(t *testing.T) {
+	var orders atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == PATH_ORDERS {
+			orders.Add(1)
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	expires := time.Now().Add(24 * time.Hour).Unix()
+	c := NewRbClient(server.URL, "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", "", "key", "0x01", "token", "", expires)
+
+	req, err := Limit("BTC-USD", "long", decimal.RequireFromString("27000"), decimal.RequireFromString("0.001")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.CreateOrderDecimal(req); !errors.Is(err, ErrMarketsUnavailable) {
+		t.Errorf("CreateOrderDecimal() error = %v, want ErrMarketsUnavailable", err)
+	}
+	if n := orders.Load(); n != 0 {
+		t.Errorf("%d orders sent without market data, want none", n)
+	}
+}
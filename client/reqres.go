@@ -2,7 +2,12 @@
 package client
 
 // Importing the decimal package for handling decimal numbers.
-import "github.com/shopspring/decimal"
+import (
+	"encoding/json"
+	"rabbitx-client/model"
+
+	"github.com/shopspring/decimal"
+)
 
 // Response is a generic struct that represents the server response for any type of request.
 // It contains fields for success status, error message, and result data.
@@ -38,6 +43,17 @@ type OrderListRequest struct {
 	OrderType     []string `json:"order_type" binding:"omitempty,dive,oneof=limit market stop_loss take_profit stop_loss_limit take_profit_limit stop_market stop_limit cancel amend"` // The type of the order.
 }
 
+// MarketListRequest represents the data required to list markets.
+// It includes a field for market IDs, all markets are listed if it is empty.
+type MarketListRequest struct {
+	MarketIds []string `json:"market_id" binding:"omitempty"` // The market IDs.
+}
+
+// OrderbookRequest represents the data required to get an orderbook snapshot.
+type OrderbookRequest struct {
+	MarketId string `json:"market_id" binding:"required"` // The market ID.
+}
+
 // OrderCreateRequest represents the data required to create a new order.
 // It includes fields for market ID, type, side, price, size, client order ID, trigger price, size percent, and time in force.
 type OrderCreateRequest struct {
@@ -63,6 +79,118 @@ type OrderAmendRequest struct {
 	SizePercent  *float64 `json:"size_percent" binding:"omitempty"`  // The new size percent of the order.
 }
 
+// DecimalOrderCreateRequest is the decimal counterpart of OrderCreateRequest.
+// Price, size, trigger price and size percent are sent as exact decimal numbers,
+// so no binary float rounding is introduced. Use Snap to align values to market ticks.
+type DecimalOrderCreateRequest struct {
+	MarketId      string           `json:"market_id" binding:"required"`                                                                                                                               // The market ID of the order.
+	Type          string           `json:"type" binding:"oneof=limit market stop_loss take_profit stop_loss_limit take_profit_limit stop_market stop_limit cancel amend,required"`                     // The type of the order.
+	Side          string           `json:"side" binding:"required_unless=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit,omitempty,oneof=short long"`                      // The side of the order.
+	Price         *decimal.Decimal `json:"price" binding:"required_if=Type limit Type stop_limit Type stop_loss_limit Type take_profit_limit,omitempty"`                                               // The price of the order.
+	Size          *decimal.Decimal `json:"size" binding:"required_unless=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit,omitempty"`                                       // The size of the order.
+	ClientOrderId *string          `json:"client_order_id" binding:"omitempty"`                                                                                                                        // The client order ID.
+	TriggerPrice  *decimal.Decimal `json:"trigger_price" binding:"required_if=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit Type stop_market Type stop_limit,omitempty"` // The trigger price of the order.
+	SizePercent   *decimal.Decimal `json:"size_percent" binding:"required_if=Type stop_loss Type take_profit Type stop_loss_limit Type take_profit_limit,omitempty"`                                   // The size percent of the order.
+	TimeInForce   *string          `json:"time_in_force" binding:"omitempty,oneof=good_till_cancel immediate_or_cancel fill_or_kill post_only"`                                                        // The time in force of the order.
+}
+
+// MarshalJSON encodes decimal fields as JSON numbers with their exact decimal representation.
+func (r DecimalOrderCreateRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		MarketId      string       `json:"market_id"`
+		Type          string       `json:"type"`
+		Side          string       `json:"side"`
+		Price         *json.Number `json:"price"`
+		Size          *json.Number `json:"size"`
+		ClientOrderId *string      `json:"client_order_id"`
+		TriggerPrice  *json.Number `json:"trigger_price"`
+		SizePercent   *json.Number `json:"size_percent"`
+		TimeInForce   *string      `json:"time_in_force"`
+	}{
+		MarketId:      r.MarketId,
+		Type:          r.Type,
+		Side:          r.Side,
+		Price:         decimalNumber(r.Price),
+		Size:          decimalNumber(r.Size),
+		ClientOrderId: r.ClientOrderId,
+		TriggerPrice:  decimalNumber(r.TriggerPrice),
+		SizePercent:   decimalNumber(r.SizePercent),
+		TimeInForce:   r.TimeInForce,
+	})
+}
+
+// Snap rounds price and trigger price to the nearest multiple of priceTick
+// and size to the nearest multiple of sizeStep. Zero tick or step leaves values untouched.
+func (r *DecimalOrderCreateRequest) Snap(priceTick, sizeStep decimal.Decimal) {
+	r.Price = snapPtr(r.Price, priceTick)
+	r.TriggerPrice = snapPtr(r.TriggerPrice, priceTick)
+	r.Size = snapPtr(r.Size, sizeStep)
+}
+
+// Decimal returns the decimal counterpart of the request.
+func (r *OrderCreateRequest) Decimal() *DecimalOrderCreateRequest {
+	return &DecimalOrderCreateRequest{
+		MarketId:      r.MarketId,
+		Type:          r.Type,
+		Side:          r.Side,
+		Price:         decimalFromFloat(r.Price),
+		Size:          decimalFromFloat(r.Size),
+		ClientOrderId: r.ClientOrderId,
+		TriggerPrice:  decimalFromFloat(r.TriggerPrice),
+		SizePercent:   decimalFromFloat(r.SizePercent),
+		TimeInForce:   r.TimeInForce,
+	}
+}
+
+// Decimal returns the decimal counterpart of the request.
+func (r *OrderAmendRequest) Decimal() *DecimalOrderAmendRequest {
+	return &DecimalOrderAmendRequest{
+		OrderId:      r.OrderId,
+		MarketId:     r.MarketId,
+		Price:        decimalFromFloat(r.Price),
+		Size:         decimalFromFloat(r.Size),
+		TriggerPrice: decimalFromFloat(r.TriggerPrice),
+		SizePercent:  decimalFromFloat(r.SizePercent),
+	}
+}
+
+// DecimalOrderAmendRequest is the decimal counterpart of OrderAmendRequest.
+type DecimalOrderAmendRequest struct {
+	OrderId      string           `json:"order_id" binding:"required"`       // The order ID.
+	MarketId     string           `json:"market_id" binding:"required"`      // The market ID of the order.
+	Price        *decimal.Decimal `json:"price" binding:"omitempty"`         // The new price of the order.
+	Size         *decimal.Decimal `json:"size" binding:"omitempty"`          // The new size of the order.
+	TriggerPrice *decimal.Decimal `json:"trigger_price" binding:"omitempty"` // The new trigger price of the order.
+	SizePercent  *decimal.Decimal `json:"size_percent" binding:"omitempty"`  // The new size percent of the order.
+}
+
+// MarshalJSON encodes decimal fields as JSON numbers with their exact decimal representation.
+func (r DecimalOrderAmendRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		OrderId      string       `json:"order_id"`
+		MarketId     string       `json:"market_id"`
+		Price        *json.Number `json:"price"`
+		Size         *json.Number `json:"size"`
+		TriggerPrice *json.Number `json:"trigger_price"`
+		SizePercent  *json.Number `json:"size_percent"`
+	}{
+		OrderId:      r.OrderId,
+		MarketId:     r.MarketId,
+		Price:        decimalNumber(r.Price),
+		Size:         decimalNumber(r.Size),
+		TriggerPrice: decimalNumber(r.TriggerPrice),
+		SizePercent:  decimalNumber(r.SizePercent),
+	})
+}
+
+// Snap rounds price and trigger price to the nearest multiple of priceTick
+// and size to the nearest multiple of sizeStep. Zero tick or step leaves values untouched.
+func (r *DecimalOrderAmendRequest) Snap(priceTick, sizeStep decimal.Decimal) {
+	r.Price = snapPtr(r.Price, priceTick)
+	r.TriggerPrice = snapPtr(r.TriggerPrice, priceTick)
+	r.Size = snapPtr(r.Size, sizeStep)
+}
+
 // OrderCancelRequest represents the data required to cancel an existing order.
 // It includes fields for order ID, market ID, and client order ID.
 type OrderCancelRequest struct {
@@ -71,6 +199,9 @@ type OrderCancelRequest struct {
 	ClientOrderId string `json:"client_order_id" binding:"omitempty"` // The client order ID.
 }
 
+// OrderCancelAllRequest represents the data required to cancel all orders of the profile.
+type OrderCancelAllRequest struct{}
+
 // OrderCreateResponse represents the server response for a create order request.
 // It includes fields for order ID, market ID, profile ID, status, size, price, side, type, liquidation status, client order ID, trigger price, size percent, and time in force.
 type OrderCreateResponse struct {
@@ -89,6 +220,28 @@ type OrderCreateResponse struct {
 	TimeInForce   *string          `json:"time_in_force"`   // The time in force of the order.
 }
 
+// OrderData returns the order as the exchange reports it in order lists and account updates.
+func (r *OrderCreateResponse) OrderData() *model.OrderData {
+	order := &model.OrderData{
+		OrderId:       r.OrderId,
+		ProfileID:     r.ProfileId,
+		MarketID:      r.MarketId,
+		OrderType:     r.Type,
+		Status:        r.Status,
+		Price:         r.Price,
+		Size:          r.Size,
+		Side:          r.Side,
+		ClientOrderId: r.ClientOrderId,
+		TriggerPrice:  r.TriggerPrice,
+		SizePercent:   r.SizePercent,
+	}
+	if r.TimeInForce != nil {
+		order.TimeInForce = *r.TimeInForce
+	}
+
+	return order
+}
+
 // OrderCancelResponse represents the server response for a cancel order request.
 // It includes fields for order ID, market ID, profile ID, status, and client order ID.
 type OrderCancelResponse struct {
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"encoding/json"
+	"rabbitx-client/auth"
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// roundTrip signs the request body fields with auth.CanonicalPayload, rebuilds the body
+// from the payload and checks it decodes to a request with the same canonical payload.
+func roundTrip(t *testing.T, req interface{}) map[string]string {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := auth.CanonicalPayload(body)
+	if err != nil {
+		t.Fatalf("CanonicalPayload(%s) error = %v", body, err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	rebuilt := make(map[string]json.RawMessage, len(payload))
+	for k, v := range payload {
+		raw, ok := fields[k]
+		if !ok {
+			t.Fatalf("payload field %s is not in the body", k)
+		}
+
+		if raw[0] == '"' {
+			quoted, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rebuilt[k] = quoted
+		} else {
+			rebuilt[k] = json.RawMessage(v)
+		}
+	}
+
+	data, err := json.Marshal(rebuilt)
+	if err != nil {
+		t.Fatalf("rebuilt body is invalid: %v", err)
+	}
+
+	decoded := reflect.New(reflect.TypeOf(req).Elem()).Interface()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("decode rebuilt body %s: %v", data, err)
+	}
+
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := auth.CanonicalPayload(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(signed, payload) {
+		t.Errorf("round trip payload = %v, want %v", signed, payload)
+	}
+
+	return payload
+}
+
+func TestRequestPayloadRoundTrip(t *testing.T) {
+	price := 27000.5
+	size := 0.001
+	percent := 0.5
+	clientId := "bot-1"
+	postOnly := "post_only"
+	decPrice := decimal.RequireFromString("27000.50")
+	decSize := decimal.RequireFromString("0.001")
+
+	tests := []struct {
+		name string
+		req  interface{}
+		want map[string]string
+	}{
+		{"OnboardingRequest", &OnboardingRequest{IsClient: true, Wallet: "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", Signature: "0x00"},
+			map[string]string{"is_client": "true", "wallet": "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23", "signature": "0x00"}},
+		{"SecretRefreshRequest", &SecretRefreshRequest{RefreshToken: "token"},
+			map[string]string{"refresh_token": "token"}},
+		{"OrderListRequest", &OrderListRequest{MarketId: "BTC-USD", TimeStamp: 1, Status: []string{"open", "closed"}},
+			map[string]string{"market_id": "BTC-USD", "start_time": "1", "end_time": "0", "status": `["open","closed"]`,
+				"order_id": "", "client_order_id": ""}},
+		{"MarketListRequest", &MarketListRequest{MarketIds: []string{"BTC-USD"}},
+			map[string]string{"market_id": `["BTC-USD"]`}},
+		{"OrderbookRequest", &OrderbookRequest{MarketId: "BTC-USD"},
+			map[string]string{"market_id": "BTC-USD"}},
+		{"OrderCreateRequest", &OrderCreateRequest{MarketId: "BTC-USD", Type: "limit", Side: "long", Price: &price, Size: &size, ClientOrderId: &clientId, TimeInForce: &postOnly},
+			map[string]string{"market_id": "BTC-USD", "type": "limit", "side": "long", "price": "27000.5", "size": "0.001",
+				"client_order_id": "bot-1", "time_in_force": "post_only"}},
+		{"OrderAmendRequest", &OrderAmendRequest{OrderId: "1", MarketId: "BTC-USD", SizePercent: &percent},
+			map[string]string{"order_id": "1", "market_id": "BTC-USD", "size_percent": "0.5"}},
+		{"DecimalOrderCreateRequest", &DecimalOrderCreateRequest{MarketId: "BTC-USD", Type: "limit", Side: "short", Price: &decPrice, Size: &decSize},
+			map[string]string{"market_id": "BTC-USD", "type": "limit", "side": "short", "price": "27000.5", "size": "0.001"}},
+		{"DecimalOrderAmendRequest", &DecimalOrderAmendRequest{OrderId: "1", MarketId: "BTC-USD", Price: &decPrice},
+			map[string]string{"order_id": "1", "market_id": "BTC-USD", "price": "27000.5"}},
+		{"OrderCancelRequest", &OrderCancelRequest{OrderId: "1", MarketId: "BTC-USD"},
+			map[string]string{"order_id": "1", "market_id": "BTC-USD", "client_order_id": ""}},
+		{"OrderCancelAllRequest", &OrderCancelAllRequest{}, map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roundTrip(t, tt.req); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("payload = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
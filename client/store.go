@@ -0,0 +1,74 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Credentials holds everything needed to create an RbClient for one account.
+type Credentials struct {
+	Wallet       string // The wallet address.
+	PrivateKey   string // The wallet private key, optional if API secret is set.
+	APIKey       string // The API key.
+	APISecret    string // The API secret.
+	RefreshToken string // The refresh token of the API secret.
+	JwtPrivate   string // The private JWT.
+	KeyExpired   int64  // The expiration time of the API secret.
+}
+
+// Validate checks the credentials can create a client, NewRbClient panics on a malformed private key.
+func (c *Credentials) Validate() error {
+	if c.PrivateKey == "" {
+		return nil
+	}
+
+	if _, err := parsePrivateKey(c.PrivateKey); err != nil {
+		return fmt.Errorf("private key: %w", err)
+	}
+
+	return nil
+}
+
+// SecretStore is a source of account credentials keyed by account name.
+type SecretStore interface {
+	Load(name string) (*Credentials, error)
+}
+
+// EnvSecretStore loads credentials from environment variables named
+// as in .env prefixed with the upper-cased account name,
+// e.g. MAKER_WALLET, MAKER_PRIVATE_KEY, MAKER_API_KEY for account "maker".
+// Empty name reads variables without prefix.
+type EnvSecretStore struct{}
+
+// Load implements SecretStore.
+func (EnvSecretStore) Load(name string) (*Credentials, error) {
+	prefix := ""
+	if name != "" {
+		prefix = strings.ToUpper(name) + "_"
+	}
+
+	creds := &Credentials{
+		Wallet:       os.Getenv(prefix + "WALLET"),
+		PrivateKey:   os.Getenv(prefix + "PRIVATE_KEY"),
+		APIKey:       os.Getenv(prefix + "API_KEY"),
+		APISecret:    os.Getenv(prefix + "API_SECRET"),
+		RefreshToken: os.Getenv(prefix + "REFRESH_TOKEN"),
+		JwtPrivate:   os.Getenv(prefix + "PRIVATE_JWT"),
+	}
+
+	if expired := os.Getenv(prefix + "API_KEY_EXPIRED"); expired != "" {
+		keyExpired, err := strconv.ParseInt(expired, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %sAPI_KEY_EXPIRED: %w", prefix, err)
+		}
+		creds.KeyExpired = keyExpired
+	}
+
+	if creds.Wallet == "" {
+		return nil, fmt.Errorf("no credentials for account %q: %sWALLET is not set", name, prefix)
+	}
+
+	return creds, nil
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"rabbitx-client/model"
+	"sync"
+)
+
+// OrderListener receives order updates published with PublishOrderUpdate.
+// OnOrderUpdate must not block.
+type OrderListener interface {
+	OnOrderUpdate(order *model.OrderData)
+}
+
+// orderListeners is the set of listeners registered on a client.
+type orderListeners struct {
+	mu        sync.RWMutex
+	nextId    int
+	listeners map[int]OrderListener
+}
+
+// AddOrderListener registers a listener for order updates and returns a function removing it.
+func (c *RbClient) AddOrderListener(listener OrderListener) func() {
+	c.orderListeners.mu.Lock()
+	defer c.orderListeners.mu.Unlock()
+
+	if c.orderListeners.listeners == nil {
+		c.orderListeners.listeners = make(map[int]OrderListener)
+	}
+
+	id := c.orderListeners.nextId
+	c.orderListeners.nextId++
+	c.orderListeners.listeners[id] = listener
+
+	return func() {
+		c.orderListeners.mu.Lock()
+		defer c.orderListeners.mu.Unlock()
+
+		delete(c.orderListeners.listeners, id)
+	}
+}
+
+// PublishOrderUpdate forwards an order update, e.g. from the account@ channel,
+// to all registered listeners such as brackets, and records it in the client order registry.
+func (c *RbClient) PublishOrderUpdate(order *model.OrderData) {
+	if order == nil {
+		return
+	}
+
+	c.updateClientOrder(order)
+
+	c.orderListeners.mu.RLock()
+	defer c.orderListeners.mu.RUnlock()
+
+	for _, listener := range c.orderListeners.listeners {
+		listener.OnOrderUpdate(order)
+	}
+}
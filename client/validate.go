@@ -0,0 +1,205 @@
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes a request field which violates one of its binding rules.
+type FieldError struct {
+	Field string // The json name of the field.
+	Rule  string // The violated rule, e.g. required or oneof.
+	Param string // The rule parameter, if any.
+}
+
+// Error implements the error interface.
+func (e FieldError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("field %s failed on the '%s' rule", e.Field, e.Rule)
+	}
+	return fmt.Sprintf("field %s failed on the '%s=%s' rule", e.Field, e.Rule, e.Param)
+}
+
+// ValidationErrors is the list of field errors returned by Validate.
+type ValidationErrors []FieldError
+
+// Error implements the error interface.
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks a request struct against the rules of its binding tags,
+// the same tags the exchange uses to validate incoming requests.
+// Supported rules are required, omitempty, required_if, required_unless,
+// oneof, len, min, max and dive. Conditional rules list pairs of
+// field name and value and apply when any of the pairs matches, e.g.
+// required_if=Type limit Type stop_limit means required for limit or stop_limit orders.
+// Unknown rules are ignored. It returns ValidationErrors or nil.
+func Validate(request interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(request))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: expected struct, got %s", value.Kind())
+	}
+
+	var errs ValidationErrors
+	valueType := value.Type()
+	for i := 0; i < value.NumField(); i++ {
+		field := valueType.Field(i)
+		tag, ok := field.Tag.Lookup("binding")
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		name, _ := queryParamName(field)
+		if fe := validateField(value, value.Field(i), name, strings.Split(tag, ",")); fe != nil {
+			errs = append(errs, *fe)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validateField applies rules to a single field of parent struct.
+// It returns the first violated rule.
+func validateField(parent, field reflect.Value, name string, rules []string) *FieldError {
+	omitEmpty := false
+	for i, rule := range rules {
+		ruleName, param, _ := strings.Cut(rule, "=")
+
+		switch ruleName {
+		case "omitempty":
+			omitEmpty = true
+			continue
+		case "required":
+			if !hasValue(field) {
+				return &FieldError{Field: name, Rule: ruleName}
+			}
+			continue
+		case "required_if":
+			if matchAny(parent, param) && !hasValue(field) {
+				return &FieldError{Field: name, Rule: ruleName, Param: param}
+			}
+			continue
+		case "required_unless":
+			if !matchAny(parent, param) && !hasValue(field) {
+				return &FieldError{Field: name, Rule: ruleName, Param: param}
+			}
+			continue
+		}
+
+		// Remaining rules check the value itself.
+		if !hasValue(field) {
+			if omitEmpty {
+				return nil
+			}
+			// Nil pointers without required rule have nothing to check.
+			if isNilable(field) {
+				return nil
+			}
+		}
+
+		elem := reflect.Indirect(field)
+
+		if ruleName == "dive" {
+			if elem.Kind() != reflect.Slice && elem.Kind() != reflect.Array {
+				return nil
+			}
+			for j := 0; j < elem.Len(); j++ {
+				itemName := fmt.Sprintf("%s[%d]", name, j)
+				if fe := validateField(parent, elem.Index(j), itemName, rules[i+1:]); fe != nil {
+					return fe
+				}
+			}
+			return nil
+		}
+
+		if !checkRule(elem, ruleName, param) {
+			return &FieldError{Field: name, Rule: ruleName, Param: param}
+		}
+	}
+
+	return nil
+}
+
+// checkRule evaluates a value rule. Unknown rules pass.
+func checkRule(value reflect.Value, rule, param string) bool {
+	switch rule {
+	case "oneof":
+		str := fmt.Sprint(value.Interface())
+		for _, option := range strings.Fields(param) {
+			if str == option {
+				return true
+			}
+		}
+		return false
+	case "len", "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false
+		}
+
+		var size float64
+		switch value.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			size = float64(value.Len())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			size = float64(value.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			size = float64(value.Uint())
+		case reflect.Float32, reflect.Float64:
+			size = value.Float()
+		default:
+			return true
+		}
+
+		switch rule {
+		case "len":
+			return size == limit
+		case "min":
+			return size >= limit
+		default:
+			return size <= limit
+		}
+	}
+
+	return true
+}
+
+// matchAny reports whether any "Field value" pair of param matches parent fields.
+func matchAny(parent reflect.Value, param string) bool {
+	parts := strings.Fields(param)
+	for i := 0; i+1 < len(parts); i += 2 {
+		field := reflect.Indirect(parent.FieldByName(parts[i]))
+		if field.IsValid() && fmt.Sprint(field.Interface()) == parts[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasValue reports whether the value is set: non-nil for nilable kinds, non-zero otherwise.
+func hasValue(value reflect.Value) bool {
+	if isNilable(value) {
+		return !value.IsNil()
+	}
+	return !value.IsZero()
+}
+
+// isNilable reports whether the value kind can be nil.
+func isNilable(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// ruleRequest exercises every binding rule supported by Validate.
+type ruleRequest struct {
+	Kind     string     `json:"kind" binding:"oneof=a b"`
+	Name     string     `json:"name" binding:"required"`
+	Price    *float64   `json:"price" binding:"required_if=Kind a,omitempty,min=1"`
+	Size     *float64   `json:"size" binding:"required_unless=Kind a Kind c,omitempty,max=10"`
+	Code     *string    `json:"code" binding:"omitempty,len=3"`
+	Count    int        `json:"count" binding:"min=0,max=5"`
+	Tags     []string   `json:"tags" binding:"omitempty,dive,oneof=x y"`
+	Groups   [][]string `json:"groups" binding:"omitempty,dive,dive,len=1"`
+	Notes    []*string  `json:"notes" binding:"dive,omitempty,max=2"`
+	Wallet   string     `json:"wallet,omitempty" binding:"len=4,required"`
+	Unknown  string     `json:"unknown" binding:"uuid"`
+	Unbound  string     `json:"unbound"`
+	unexport string     `binding:"required"`
+}
+
+// validRuleRequest returns a request passing every rule.
+func validRuleRequest() ruleRequest {
+	price := 2.0
+	return ruleRequest{Kind: "a", Name: "n", Price: &price, Wallet: "0x01"}
+}
+
+func TestValidateRules(t *testing.T) {
+	zero, big := 0.5, 11.0
+	short, exact := "ab", "abc"
+
+	tests := []struct {
+		name   string
+		modify func(r *ruleRequest)
+		want   []FieldError
+	}{
+		{"valid", func(r *ruleRequest) {}, nil},
+		{"required", func(r *ruleRequest) { r.Name = "" }, []FieldError{{Field: "name", Rule: "required"}}},
+		{"oneof", func(r *ruleRequest) { r.Kind = "z" }, []FieldError{
+			{Field: "kind", Rule: "oneof", Param: "a b"},
+			// z is neither a nor c, so size becomes required.
+			{Field: "size", Rule: "required_unless", Param: "Kind a Kind c"},
+		}},
+		{"required_if matched", func(r *ruleRequest) { r.Price = nil }, []FieldError{{Field: "price", Rule: "required_if", Param: "Kind a"}}},
+		{"required_if not matched", func(r *ruleRequest) { r.Kind, r.Price, r.Size = "b", nil, &zero }, nil},
+		{"required_unless matched", func(r *ruleRequest) { r.Kind, r.Size = "b", nil }, []FieldError{{Field: "size", Rule: "required_unless", Param: "Kind a Kind c"}}},
+		{"min on pointer", func(r *ruleRequest) { r.Price = &zero }, []FieldError{{Field: "price", Rule: "min", Param: "1"}}},
+		{"max on pointer", func(r *ruleRequest) { r.Size = &big }, []FieldError{{Field: "size", Rule: "max", Param: "10"}}},
+		{"len on pointer", func(r *ruleRequest) { r.Code = &short }, []FieldError{{Field: "code", Rule: "len", Param: "3"}}},
+		{"len on pointer passes", func(r *ruleRequest) { r.Code = &exact }, nil},
+		{"max on int", func(r *ruleRequest) { r.Count = 6 }, []FieldError{{Field: "count", Rule: "max", Param: "5"}}},
+		{"min on int", func(r *ruleRequest) { r.Count = -1 }, []FieldError{{Field: "count", Rule: "min", Param: "0"}}},
+		{"len and required order", func(r *ruleRequest) { r.Wallet = "" }, []FieldError{{Field: "wallet", Rule: "len", Param: "4"}}},
+		{"dive", func(r *ruleRequest) { r.Tags = []string{"x", "z"} }, []FieldError{{Field: "tags[1]", Rule: "oneof", Param: "x y"}}},
+		{"empty dive", func(r *ruleRequest) { r.Tags = []string{} }, nil},
+		{"nested dive", func(r *ruleRequest) { r.Groups = [][]string{{"a"}, {"b", "cd"}} }, []FieldError{{Field: "groups[1][1]", Rule: "len", Param: "1"}}},
+		{"nested dive passes", func(r *ruleRequest) { r.Groups = [][]string{{"a"}, {"b", "c"}} }, nil},
+		{"dive over pointers", func(r *ruleRequest) { r.Notes = []*string{nil, &short, &exact} }, []FieldError{{Field: "notes[2]", Rule: "max", Param: "2"}}},
+		{"several fields", func(r *ruleRequest) { r.Name, r.Count = "", 9 }, []FieldError{
+			{Field: "name", Rule: "required"},
+			{Field: "count", Rule: "max", Param: "5"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validRuleRequest()
+			tt.modify(&req)
+
+			err := Validate(&req)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Validate() = %v, want ValidationErrors", err)
+			}
+			if !reflect.DeepEqual([]FieldError(errs), tt.want) {
+				t.Errorf("Validate() = %+v, want %+v", []FieldError(errs), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRequests(t *testing.T) {
+	price := decimal.RequireFromString("27000")
+	size := decimal.RequireFromString("0.001")
+	percent := decimal.RequireFromString("1")
+
+	tests := []struct {
+		name    string
+		req     interface{}
+		wantErr bool
+	}{
+		{"limit", &DecimalOrderCreateRequest{MarketId: "BTC-USD", Type: "limit", Side: "long", Price: &price, Size: &size}, false},
+		{"limit without price", &DecimalOrderCreateRequest{MarketId: "BTC-USD", Type: "limit", Side: "long", Size: &size}, true},
+		{"market", &DecimalOrderCreateRequest{MarketId: "BTC-USD", Type: "market", Side: "short", Size: &size}, false},
+		{"unknown type", &DecimalOrderCreateRequest{MarketId: "BTC-USD", Type: "iceberg", Side: "long", Size: &size}, true},
+		{"stop loss without side and size", &DecimalOrderCreateRequest{MarketId: "BTC-USD", Type: "stop_loss", TriggerPrice: &price, SizePercent: &percent}, false},
+		{"stop loss without trigger", &DecimalOrderCreateRequest{MarketId: "BTC-USD", Type: "stop_loss", SizePercent: &percent}, true},
+		{"order list statuses", &OrderListRequest{Status: []string{"open", "closed"}}, false},
+		{"order list unknown status", &OrderListRequest{Status: []string{"open", "gone"}}, true},
+		{"cancel without market", &OrderCancelRequest{OrderId: "1"}, true},
+		{"onboarding wallet length", &OnboardingRequest{Wallet: "0x01", Signature: "0x01"}, true},
+		{"not a struct", "x", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
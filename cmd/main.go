@@ -3,18 +3,24 @@ package main
 
 // Importing necessary packages.
 import (
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"rabbitx-client/bot"
 	"rabbitx-client/client"
+	"rabbitx-client/stream"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/joho/godotenv"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
-// marketID is the ID of the market to be monitored.
-var marketID = "ETH-USD"
+// marketIDs are the IDs of the markets to be monitored, MARKET_IDS overrides them with a comma separated list.
+var marketIDs = []string{"ETH-USD"}
 
 // main is the main function of the application.
 // It loads environment variables, initializes the client and the bot, and runs the bot.
@@ -24,24 +30,64 @@ func main() {
 		log.Fatalf("Error loading .env file: %s", err)
 	}
 
-	// Parse API_KEY_EXPIRED environment variable.
-	keyExpired, err := strconv.ParseInt(os.Getenv("API_KEY_EXPIRED"), 10, 32)
+	// Select environment, API_URL and WS_URL are used for the custom one.
+	env, err := client.EnvironmentFromEnv()
 	if err != nil {
-		log.Fatalf("Failed to convert API_KEY_EXPIRED to int: %s", err)
+		log.Fatalf("Failed to select environment: %s", err)
 	}
 
-	// Initialize the client with environment variables.
-	rbClient := client.NewRbClient(
-		os.Getenv("API_URL"),
-		os.Getenv("WALLET"),
-		os.Getenv("PRIVATE_KEY"),
-		os.Getenv("API_KEY"),
-		os.Getenv("API_SECRET"),
-		os.Getenv("REFRESH_TOKEN"),
-		os.Getenv("PRIVATE_JWT"),
-		keyExpired)
+	// Select markets to trade.
+	if ids := os.Getenv("MARKET_IDS"); ids != "" {
+		marketIDs = nil
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				marketIDs = append(marketIDs, id)
+			}
+		}
+	}
+
+	// Replay a recording instead of trading.
+	if path := os.Getenv("REPLAY"); path != "" {
+		replay(env, path)
+		return
+	}
 
-	logrus.Info("Client successfully created")
+	// Follow public market data only, no credentials are loaded.
+	if os.Getenv("PUBLIC_ONLY") == "true" {
+		runPublic(env)
+		return
+	}
+
+	// Load credentials from environment variables.
+	creds, err := client.EnvSecretStore{}.Load("")
+	if err != nil {
+		log.Fatalf("Failed to load credentials: %s", err)
+	}
+
+	// Initialize the client for the selected environment.
+	rbClient := client.NewRbClientForEnvironment(env, creds)
+
+	// Trading on mainnet requires explicit opt-in.
+	if env.Mainnet {
+		if os.Getenv("ALLOW_MAINNET") != "true" {
+			log.Fatalf("Environment %s trades real funds, set ALLOW_MAINNET=true to run the bot", env.Name)
+		}
+		rbClient.AllowMainnet(true)
+	}
+
+	logrus.Infof("Client successfully created for %s", env.Name)
+
+	// Keep client order IDs across restarts.
+	registry, err := client.NewClientOrderRegistry("./client_orders.json")
+	if err != nil {
+		log.Fatalf("Failed to load client order registry: %s", err)
+	}
+	rbClient.SetClientOrderRegistry(registry)
+
+	// Estimate server clock offset before signing anything.
+	if _, err := rbClient.SyncClock(); err != nil {
+		logrus.Warnf("Failed to sync clock with server: %s", err)
+	}
 
 	// Update secrets.
 	_, _, jwtPrivate, err := rbClient.GetSecrets()
@@ -55,8 +101,28 @@ func main() {
 	}
 
 	// Initialize and run the bot.
-	rbBot := bot.NewBot(rbClient, os.Getenv("WS_URL"), jwtPrivate)
-	if err := rbBot.Run(marketID); err != nil {
+	rbBot := bot.NewBot(rbClient, env.WsUrl, jwtPrivate)
+
+	// Select the strategy, the dummy one by default.
+	if os.Getenv("STRATEGY") == "marketmaker" {
+		config, err := marketMakerConfig()
+		if err != nil {
+			log.Fatalf("Invalid market maker configuration: %s", err)
+		}
+		rbBot.SetStrategy(bot.MarketMakerFactory(config))
+	}
+
+	// Record websocket traffic for replay.
+	var recorder *stream.Recorder
+	if dir := os.Getenv("RECORD_DIR"); dir != "" {
+		recorder, err = stream.NewRecorder(stream.RecorderConfig{Dir: dir})
+		if err != nil {
+			log.Fatalf("Failed to create recorder: %s", err)
+		}
+		rbBot.SetRecorder(recorder)
+	}
+
+	if err := rbBot.Run(marketIDs...); err != nil {
 		log.Fatalf("Failed to run bot: %s", err)
 	}
 
@@ -65,5 +131,97 @@ func main() {
 	// TODO: Launch webserver here to see the bot stats.
 
 	// Exit on ctrl+c.
-	select {}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	// Let strategies clean up before exiting.
+	rbBot.Stop()
+
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			logrus.Errorf("Failed to close recorder: %s", err)
+		}
+	}
+
+	// Write client order IDs not flushed yet.
+	if err := registry.Close(); err != nil {
+		logrus.Errorf("Failed to save client order registry: %s", err)
+	}
+}
+
+// runPublic follows public channels of the markets without credentials until ctrl+c.
+func runPublic(env client.Environment) {
+	rbBot := bot.NewBot(client.NewPublicClient(env), env.WsUrl, os.Getenv("PUBLIC_JWT"))
+	if err := rbBot.RunPublic(marketIDs...); err != nil {
+		log.Fatalf("Failed to run public bot: %s", err)
+	}
+
+	logrus.Info("Public market data mode launched")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	rbBot.Stop()
+}
+
+// replay feeds the recording at path, a file or a directory, through the bot without trading.
+// REPLAY_SPEED sets the playback speed, 1 by default, 0 replays without delay.
+func replay(env client.Environment, path string) {
+	replayer, err := stream.NewReplayer(path)
+	if err != nil {
+		log.Fatalf("Failed to open recording: %s", err)
+	}
+
+	speed := 1.0
+	if value := os.Getenv("REPLAY_SPEED"); value != "" {
+		speed, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("Invalid REPLAY_SPEED: %s", err)
+		}
+	}
+
+	rbBot := bot.NewBot(client.NewPublicClient(env), env.WsUrl, "")
+	if err := rbBot.Replay(replayer, stream.ReplayOptions{Speed: speed}, marketIDs...); err != nil {
+		log.Fatalf("Failed to replay: %s", err)
+	}
+
+	logrus.Info("Replay finished")
+}
+
+// marketMakerConfig returns the default market maker configuration overridden by
+// MM_SPREAD, MM_LEVEL_SPACING, MM_SIZE, MM_LEVELS, MM_MAX_POSITION and MM_SKEW.
+func marketMakerConfig() (bot.MarketMakerConfig, error) {
+	config := bot.DefaultMarketMakerConfig()
+
+	decimals := map[string]*decimal.Decimal{
+		"MM_SPREAD":        &config.Spread,
+		"MM_LEVEL_SPACING": &config.LevelSpacing,
+		"MM_SIZE":          &config.Size,
+		"MM_MAX_POSITION":  &config.MaxPosition,
+		"MM_SKEW":          &config.Skew,
+	}
+	for name, field := range decimals {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := decimal.NewFromString(value)
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", name, err)
+		}
+		*field = parsed
+	}
+
+	if value := os.Getenv("MM_LEVELS"); value != "" {
+		levels, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("MM_LEVELS: %w", err)
+		}
+		config.Levels = levels
+	}
+
+	return config, nil
 }
@@ -47,6 +47,12 @@ const (
 
 	// STOP_MARKET represents a stop market order type.
 	STOP_MARKET = "stop_market"
+
+	// STOP_LOSS_LIMIT represents a stop loss limit order type.
+	STOP_LOSS_LIMIT = "stop_loss_limit"
+
+	// TAKE_PROFIT_LIMIT represents a take profit limit order type.
+	TAKE_PROFIT_LIMIT = "take_profit_limit"
 )
 
 // Constants for account prefix and balance operations statuses.
@@ -102,3 +108,24 @@ const (
 	// CANCELINGALL represents a canceling all order status.
 	CANCELINGALL = "cancelingall"
 )
+
+// Constants for market statuses.
+const (
+	// MARKET_STATUS_ACTIVE represents an active market status.
+	MARKET_STATUS_ACTIVE = "active"
+)
+
+// Constants for order time in force.
+const (
+	// GOOD_TILL_CANCEL represents an order which rests until canceled.
+	GOOD_TILL_CANCEL = "good_till_cancel"
+
+	// IMMEDIATE_OR_CANCEL represents an order which cancels the part not filled immediately.
+	IMMEDIATE_OR_CANCEL = "immediate_or_cancel"
+
+	// FILL_OR_KILL represents an order which is either filled completely or canceled.
+	FILL_OR_KILL = "fill_or_kill"
+
+	// POST_ONLY represents an order which is canceled instead of taking liquidity.
+	POST_ONLY = "post_only"
+)
@@ -0,0 +1,356 @@
+// Package orderbook maintains local L2 order books from orderbook: channel updates.
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+	"rabbitx-client/model"
+	"rabbitx-client/stream"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// MIN_RESYNC_INTERVAL is the minimum time between two REST snapshot requests.
+const MIN_RESYNC_INTERVAL = time.Second
+
+// MAX_PENDING_UPDATES is the number of updates buffered while the book is unsynced,
+// the oldest are dropped beyond it.
+const MAX_PENDING_UPDATES = 10000
+
+// ErrNotSynced is returned when the book has no consistent state yet.
+var ErrNotSynced = errors.New("orderbook is not synced")
+
+// SnapshotFunc loads a full orderbook snapshot, e.g. RbClient.GetOrderbook.
+type SnapshotFunc func(marketId string) (*model.OrderbookData, error)
+
+// Level is an aggregated price level.
+type Level struct {
+	Price decimal.Decimal // The price of the level.
+	Size  decimal.Decimal // The total size at the price.
+}
+
+// Snapshot is a consistent copy of the book.
+type Snapshot struct {
+	MarketID  string  // The market ID of the book.
+	Sequence  uint    // The sequence of the last applied update.
+	Timestamp int64   // The timestamp of the last applied update.
+	Bids      []Level // The bids, best first.
+	Asks      []Level // The asks, best first.
+}
+
+// Book is a local L2 book of one market. Updates are applied by price level,
+// a level with zero size is removed. Every update must carry the sequence
+// following the last applied one: older updates are ignored, a gap marks
+// the book unsynced and triggers a resync from a REST snapshot. Updates
+// arriving while the book is unsynced are buffered and those newer than
+// the snapshot are replayed on top of it.
+type Book struct {
+	marketId   string
+	snapshotFn SnapshotFunc
+	mu         sync.RWMutex
+	synced     bool
+	resyncing  bool
+	pending    []model.OrderbookData
+	sequence   uint
+	timestamp  int64
+	bids       []Level
+	asks       []Level
+	lastResync time.Time
+	gaps       uint64
+}
+
+// New creates a new unsynced Book. It is synced by the first Resync or Apply.
+func New(marketId string, snapshotFn SnapshotFunc) *Book {
+	return &Book{
+		marketId:   marketId,
+		snapshotFn: snapshotFn,
+	}
+}
+
+// Follow subscribes the book to the orderbook channel of the stream and applies
+// updates in a background goroutine until the stream is closed.
+// It returns a function unsubscribing the book.
+func (b *Book) Follow(ws *stream.Stream) (func(), error) {
+	updates, unsubscribe, err := ws.Orderbook(b.marketId)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for update := range updates {
+			update := update
+			if err := b.Apply(&update); err != nil {
+				logrus.Warnf("Orderbook %s: %s", b.marketId, err)
+			}
+		}
+	}()
+
+	return unsubscribe, nil
+}
+
+// Apply applies an orderbook: channel update. If the book is not synced
+// or the update reveals a sequence gap, the update is buffered and the book
+// is resynced from a snapshot. Updates arriving while a snapshot loads are
+// buffered and replayed once it is applied.
+func (b *Book) Apply(update *model.OrderbookData) error {
+	if update.MarketID != "" && update.MarketID != b.marketId {
+		return fmt.Errorf("update of market %s applied to %s", update.MarketID, b.marketId)
+	}
+
+	b.mu.Lock()
+	switch {
+	case b.resyncing:
+		b.buffer(update)
+		b.mu.Unlock()
+		return nil
+	case !b.synced:
+		b.buffer(update)
+	case update.Sequence <= b.sequence:
+		// Stale or duplicate, already part of the book.
+		b.mu.Unlock()
+		return nil
+	case update.Sequence != b.sequence+1:
+		logrus.Warnf("Orderbook %s sequence gap: expected %d, got %d", b.marketId, b.sequence+1, update.Sequence)
+		b.synced = false
+		b.gaps++
+		b.buffer(update)
+	default:
+		b.applyUpdate(update)
+		b.mu.Unlock()
+		return nil
+	}
+	b.mu.Unlock()
+
+	return b.resyncThrottled()
+}
+
+// Resync replaces the book with a REST snapshot and replays the buffered
+// updates newer than it. It returns ErrNotSynced if the buffered updates
+// do not follow the snapshot, the next update resyncs again.
+func (b *Book) Resync() error {
+	b.mu.Lock()
+	if b.resyncing {
+		// The snapshot in flight syncs the book.
+		b.mu.Unlock()
+		return nil
+	}
+	b.resyncing = true
+	b.lastResync = time.Now()
+	b.mu.Unlock()
+
+	snap, err := b.snapshotFn(b.marketId)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.resyncing = false
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	b.bids = applyLevels(nil, snap.Bids, true)
+	b.asks = applyLevels(nil, snap.Asks, false)
+	b.sequence = snap.Sequence
+	b.timestamp = snap.Timestamp
+	b.synced = true
+
+	pending := b.pending
+	b.pending = nil
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Sequence < pending[j].Sequence
+	})
+
+	replayed := 0
+	for i := range pending {
+		update := &pending[i]
+		if update.Sequence <= b.sequence {
+			continue
+		}
+		if update.Sequence != b.sequence+1 {
+			logrus.Warnf("Orderbook %s snapshot at %d is older than buffered update %d", b.marketId, snap.Sequence, update.Sequence)
+			b.synced = false
+			b.gaps++
+			b.pending = pending[i:]
+			return ErrNotSynced
+		}
+
+		b.applyUpdate(update)
+		replayed++
+	}
+
+	logrus.Infof("Orderbook %s synced at sequence %d, %d buffered updates replayed", b.marketId, b.sequence, replayed)
+
+	return nil
+}
+
+// Synced reports whether the book is consistent.
+func (b *Book) Synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.synced
+}
+
+// Gaps returns the number of sequence gaps detected.
+func (b *Book) Gaps() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.gaps
+}
+
+// BestBid returns the best bid level.
+func (b *Book) BestBid() (Level, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return best(b.synced, b.bids)
+}
+
+// BestAsk returns the best ask level.
+func (b *Book) BestAsk() (Level, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return best(b.synced, b.asks)
+}
+
+// Mid returns the middle between the best bid and the best ask.
+func (b *Book) Mid() (decimal.Decimal, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	bid, err := best(b.synced, b.bids)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	ask, err := best(b.synced, b.asks)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return bid.Price.Add(ask.Price).Div(decimal.NewFromInt(2)), nil
+}
+
+// Depth returns up to n best levels of each side, all levels if n is not positive.
+func (b *Book) Depth(n int) (bids, asks []Level, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.synced {
+		return nil, nil, ErrNotSynced
+	}
+
+	return copyLevels(b.bids, n), copyLevels(b.asks, n), nil
+}
+
+// Snapshot returns a consistent copy of the whole book.
+func (b *Book) Snapshot() (Snapshot, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.synced {
+		return Snapshot{}, ErrNotSynced
+	}
+
+	return Snapshot{
+		MarketID:  b.marketId,
+		Sequence:  b.sequence,
+		Timestamp: b.timestamp,
+		Bids:      copyLevels(b.bids, 0),
+		Asks:      copyLevels(b.asks, 0),
+	}, nil
+}
+
+// resyncThrottled resyncs unless a resync was attempted recently.
+func (b *Book) resyncThrottled() error {
+	b.mu.RLock()
+	recent := time.Since(b.lastResync) < MIN_RESYNC_INTERVAL
+	b.mu.RUnlock()
+
+	if recent {
+		return ErrNotSynced
+	}
+
+	return b.Resync()
+}
+
+// applyUpdate applies the levels of the update. Caller must hold mu.
+func (b *Book) applyUpdate(update *model.OrderbookData) {
+	b.bids = applyLevels(b.bids, update.Bids, true)
+	b.asks = applyLevels(b.asks, update.Asks, false)
+	b.sequence = update.Sequence
+	b.timestamp = update.Timestamp
+}
+
+// buffer keeps the update for replay after the next snapshot. Caller must hold mu.
+func (b *Book) buffer(update *model.OrderbookData) {
+	if len(b.pending) >= MAX_PENDING_UPDATES {
+		b.pending = b.pending[1:]
+	}
+
+	b.pending = append(b.pending, *update)
+}
+
+// applyLevels applies [price, size] updates to levels sorted best first.
+// descending is true for bids.
+func applyLevels(levels []Level, updates [][]decimal.Decimal, descending bool) []Level {
+	for _, u := range updates {
+		if len(u) < 2 {
+			continue
+		}
+		price, size := u[0], u[1]
+
+		i := sort.Search(len(levels), func(i int) bool {
+			if descending {
+				return levels[i].Price.LessThanOrEqual(price)
+			}
+			return levels[i].Price.GreaterThanOrEqual(price)
+		})
+		found := i < len(levels) && levels[i].Price.Equal(price)
+
+		switch {
+		case size.IsZero() && found:
+			levels = append(levels[:i], levels[i+1:]...)
+		case size.IsZero():
+		case found:
+			levels[i].Size = size
+		default:
+			levels = append(levels, Level{})
+			copy(levels[i+1:], levels[i:])
+			levels[i] = Level{Price: price, Size: size}
+		}
+	}
+
+	return levels
+}
+
+// best returns the first level.
+func best(synced bool, levels []Level) (Level, error) {
+	if !synced {
+		return Level{}, ErrNotSynced
+	}
+
+	if len(levels) == 0 {
+		return Level{}, errors.New("orderbook side is empty")
+	}
+
+	return levels[0], nil
+}
+
+// copyLevels returns a copy of up to n first levels, all if n is not positive.
+func copyLevels(levels []Level, n int) []Level {
+	if n <= 0 || n > len(levels) {
+		n = len(levels)
+	}
+
+	res := make([]Level, n)
+	copy(res, levels[:n])
+
+	return res
+}
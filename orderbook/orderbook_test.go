@@ -0,0 +1,303 @@
+package orderbook
+
+import (
+	"errors"
+	"rabbitx-client/model"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// levels parses alternating prices and sizes into [price, size] updates.
+func levels(values ...string) [][]decimal.Decimal {
+	var res [][]decimal.Decimal
+	for i := 0; i+1 < len(values); i += 2 {
+		res = append(res, []decimal.Decimal{decimal.RequireFromString(values[i]), decimal.RequireFromString(values[i+1])})
+	}
+
+	return res
+}
+
+// formatLevels formats levels as alternating prices and sizes.
+func formatLevels(levels []Level) []string {
+	res := []string{}
+	for _, l := range levels {
+		res = append(res, l.Price.String(), l.Size.String())
+	}
+
+	return res
+}
+
+// fakeSnapshots serves snapshots and counts the requests.
+type fakeSnapshots struct {
+	mu       sync.Mutex
+	snapshot model.OrderbookData
+	err      error
+	requests int
+}
+
+// load implements SnapshotFunc.
+func (f *fakeSnapshots) load(marketId string) (*model.OrderbookData, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if f.err != nil {
+		return nil, f.err
+	}
+	snap := f.snapshot
+
+	return &snap, nil
+}
+
+// newTestBook returns a book synced from a snapshot at sequence 10.
+func newTestBook(t *testing.T) (*Book, *fakeSnapshots) {
+	t.Helper()
+
+	f := &fakeSnapshots{snapshot: model.OrderbookData{
+		MarketID: "BTC-USD",
+		Bids:     levels("100", "1", "99", "2"),
+		Asks:     levels("101", "1", "102", "2"),
+		Sequence: 10,
+	}}
+	b := New("BTC-USD", f.load)
+	if err := b.Resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b, f
+}
+
+// checkBook compares the sequence and levels of the book.
+func checkBook(t *testing.T, b *Book, sequence uint, bids, asks []string) {
+	t.Helper()
+
+	snap, err := b.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Sequence != sequence {
+		t.Errorf("sequence = %d, want %d", snap.Sequence, sequence)
+	}
+	if got := formatLevels(snap.Bids); !reflect.DeepEqual(got, bids) {
+		t.Errorf("bids = %v, want %v", got, bids)
+	}
+	if got := formatLevels(snap.Asks); !reflect.DeepEqual(got, asks) {
+		t.Errorf("asks = %v, want %v", got, asks)
+	}
+}
+
+func TestApplyLevels(t *testing.T) {
+	tests := []struct {
+		name       string
+		levels     []string
+		updates    [][]decimal.Decimal
+		descending bool
+		want       []string
+	}{
+		{"insert into empty", nil, levels("100", "1"), true, []string{"100", "1"}},
+		{"insert best bid", []string{"100", "1"}, levels("101", "2"), true, []string{"101", "2", "100", "1"}},
+		{"insert middle bid", []string{"101", "1", "99", "1"}, levels("100", "2"), true, []string{"101", "1", "100", "2", "99", "1"}},
+		{"insert worst bid", []string{"101", "1"}, levels("99", "2"), true, []string{"101", "1", "99", "2"}},
+		{"insert best ask", []string{"101", "1"}, levels("100", "2"), false, []string{"100", "2", "101", "1"}},
+		{"insert worst ask", []string{"101", "1"}, levels("102", "2"), false, []string{"101", "1", "102", "2"}},
+		{"update size", []string{"101", "1", "100", "1"}, levels("100", "3"), true, []string{"101", "1", "100", "3"}},
+		{"equal prices with other scale", []string{"100", "1"}, levels("100.00", "3"), true, []string{"100", "3"}},
+		{"delete", []string{"101", "1", "100", "1", "99", "1"}, levels("100", "0"), true, []string{"101", "1", "99", "1"}},
+		{"delete last", []string{"100", "1"}, levels("100", "0"), false, []string{}},
+		{"delete missing", []string{"100", "1"}, levels("99", "0"), true, []string{"100", "1"}},
+		{"several", []string{"100", "1"}, levels("101", "1", "100", "0", "102", "5"), false, []string{"101", "1", "102", "5"}},
+		{"malformed update", []string{"100", "1"}, [][]decimal.Decimal{{decimal.NewFromInt(1)}}, true, []string{"100", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var book []Level
+			for _, u := range levels(tt.levels...) {
+				book = append(book, Level{Price: u[0], Size: u[1]})
+			}
+
+			if got := formatLevels(applyLevels(book, tt.updates, tt.descending)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyLevels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyInSequence(t *testing.T) {
+	b, f := newTestBook(t)
+
+	tests := []struct {
+		name   string
+		update model.OrderbookData
+	}{
+		{"next", model.OrderbookData{Sequence: 11, Bids: levels("100", "0")}},
+		{"stale", model.OrderbookData{Sequence: 5, Bids: levels("98", "1")}},
+		{"duplicate", model.OrderbookData{Sequence: 11, Bids: levels("98", "1")}},
+		{"next again", model.OrderbookData{Sequence: 12, Asks: levels("100.5", "3")}},
+	}
+	for _, tt := range tests {
+		if err := b.Apply(&tt.update); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+	}
+
+	checkBook(t, b, 12, []string{"99", "2"}, []string{"100.5", "3", "101", "1", "102", "2"})
+	if f.requests != 1 || b.Gaps() != 0 {
+		t.Errorf("snapshots = %d, gaps = %d, want 1 and 0", f.requests, b.Gaps())
+	}
+}
+
+func TestApplyOtherMarket(t *testing.T) {
+	b, _ := newTestBook(t)
+
+	if err := b.Apply(&model.OrderbookData{MarketID: "ETH-USD", Sequence: 11}); err == nil {
+		t.Error("Apply() of another market succeeded")
+	}
+}
+
+func TestGapResyncsFromSnapshot(t *testing.T) {
+	b, f := newTestBook(t)
+	b.lastResync = time.Time{}
+
+	// Update 11 is lost, the snapshot already contains 11 and 12.
+	f.snapshot = model.OrderbookData{
+		Bids:     levels("100", "5"),
+		Asks:     levels("101", "5"),
+		Sequence: 12,
+	}
+	if err := b.Apply(&model.OrderbookData{Sequence: 12, Bids: levels("100", "4")}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBook(t, b, 12, []string{"100", "5"}, []string{"101", "5"})
+	if f.requests != 2 || b.Gaps() != 1 {
+		t.Errorf("snapshots = %d, gaps = %d, want 2 and 1", f.requests, b.Gaps())
+	}
+}
+
+func TestGapReplaysUpdatesNewerThanSnapshot(t *testing.T) {
+	b, f := newTestBook(t)
+	b.lastResync = time.Time{}
+
+	// The snapshot is taken between the buffered updates 12 and 13.
+	f.snapshot = model.OrderbookData{
+		Bids:     levels("100", "5"),
+		Asks:     levels("101", "5"),
+		Sequence: 12,
+	}
+	if err := b.Apply(&model.OrderbookData{Sequence: 13, Bids: levels("100", "0")}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBook(t, b, 13, []string{}, []string{"101", "5"})
+}
+
+func TestThrottledResyncBuffersUpdates(t *testing.T) {
+	b, f := newTestBook(t)
+
+	f.snapshot = model.OrderbookData{Bids: levels("100", "5"), Sequence: 12}
+	if err := b.Apply(&model.OrderbookData{Sequence: 12}); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("Apply() = %v, want ErrNotSynced while throttled", err)
+	}
+	if err := b.Apply(&model.OrderbookData{Sequence: 13, Bids: levels("99", "1")}); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("Apply() = %v, want ErrNotSynced while throttled", err)
+	}
+	if b.Synced() {
+		t.Fatal("book is synced after a gap")
+	}
+
+	b.lastResync = time.Time{}
+	if err := b.Apply(&model.OrderbookData{Sequence: 14, Bids: levels("98", "1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBook(t, b, 14, []string{"100", "5", "99", "1", "98", "1"}, []string{})
+}
+
+func TestSnapshotOlderThanBuffer(t *testing.T) {
+	b, f := newTestBook(t)
+	b.lastResync = time.Time{}
+
+	// Updates 11 and 12 are lost and the snapshot does not contain them yet.
+	if err := b.Apply(&model.OrderbookData{Sequence: 13}); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("Apply() = %v, want ErrNotSynced", err)
+	}
+	if b.Synced() || b.Gaps() != 2 {
+		t.Fatalf("synced = %t, gaps = %d, want false and 2", b.Synced(), b.Gaps())
+	}
+
+	b.lastResync = time.Time{}
+	f.snapshot = model.OrderbookData{Asks: levels("101", "5"), Sequence: 13}
+	if err := b.Apply(&model.OrderbookData{Sequence: 14, Asks: levels("102", "1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBook(t, b, 14, []string{}, []string{"101", "5", "102", "1"})
+}
+
+func TestUpdatesDuringResyncAreReplayed(t *testing.T) {
+	f := &fakeSnapshots{snapshot: model.OrderbookData{Bids: levels("100", "1"), Sequence: 20}}
+	loading, release := make(chan struct{}), make(chan struct{})
+	b := New("BTC-USD", func(marketId string) (*model.OrderbookData, error) {
+		close(loading)
+		<-release
+		return f.load(marketId)
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- b.Apply(&model.OrderbookData{Sequence: 19})
+	}()
+	<-loading
+
+	updates := []model.OrderbookData{
+		{Sequence: 20, Bids: levels("100", "9")},
+		{Sequence: 22, Bids: levels("98", "1")},
+		{Sequence: 21, Bids: levels("99", "1")},
+	}
+	for i := range updates {
+		if err := b.Apply(&updates[i]); err != nil {
+			t.Fatalf("Apply() during resync = %v", err)
+		}
+	}
+	if err := b.Resync(); err != nil {
+		t.Fatalf("Resync() during resync = %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	checkBook(t, b, 22, []string{"100", "1", "99", "1", "98", "1"}, []string{})
+	if f.requests != 1 {
+		t.Errorf("snapshots = %d, want 1", f.requests)
+	}
+}
+
+func TestFailedSnapshot(t *testing.T) {
+	f := &fakeSnapshots{err: errors.New("unavailable")}
+	b := New("BTC-USD", f.load)
+
+	if err := b.Apply(&model.OrderbookData{Sequence: 1}); err == nil {
+		t.Fatal("Apply() succeeded without a snapshot")
+	}
+	if _, err := b.Mid(); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("Mid() = %v, want ErrNotSynced", err)
+	}
+
+	b.lastResync = time.Time{}
+	f.err = nil
+	f.snapshot = model.OrderbookData{Bids: levels("100", "1"), Asks: levels("102", "1")}
+	if err := b.Apply(&model.OrderbookData{Sequence: 2, Asks: levels("101", "1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if mid, err := b.Mid(); err != nil || !mid.Equal(decimal.RequireFromString("100.5")) {
+		t.Errorf("Mid() = %s, %v, want 100.5", mid, err)
+	}
+}
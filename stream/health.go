@@ -0,0 +1,287 @@
+package stream
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DEFAULT_HEALTH_CHECK_INTERVAL is the time between two staleness checks.
+const DEFAULT_HEALTH_CHECK_INTERVAL = time.Second
+
+// HealthConfig configures a HealthMonitor.
+type HealthConfig struct {
+	StaleAfter    map[string]time.Duration // The silence after which a channel is stale, by channel prefix.
+	CheckInterval time.Duration            // The time between checks, DEFAULT_HEALTH_CHECK_INTERVAL if zero.
+}
+
+// DefaultHealthConfig returns thresholds for market data channels. Trade and account
+// channels are quiet whenever nobody trades, so they are not checked for staleness.
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		StaleAfter: map[string]time.Duration{
+			MARKET_PREFIX:    15 * time.Second,
+			ORDERBOOK_PREFIX: 30 * time.Second,
+		},
+	}
+}
+
+// ChannelHealth holds liveness metrics of a channel.
+type ChannelHealth struct {
+	Channel     string        // The websocket channel.
+	LastMessage time.Time     // The receive time of the last publication, zero if none yet.
+	Messages    uint64        // The number of publications received.
+	Rate        float64       // The publications per second since the previous check.
+	Latency     time.Duration // The receive time minus the payload timestamp of the last publication.
+	Stale       bool          // Whether the channel is silent longer than its threshold.
+}
+
+// HealthMonitor tracks liveness of channels and reports channels gone silent.
+// Feed it with Stream.Tap(monitor.Observe) and Watch the channels which must stay alive,
+// so a channel that never delivers anything also becomes stale.
+type HealthMonitor struct {
+	config   HealthConfig
+	mu       sync.Mutex
+	channels map[string]*channelHealth
+	onStale  []func(ChannelHealth)
+	onFresh  []func(ChannelHealth)
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// channelHealth is the tracked state of a channel.
+type channelHealth struct {
+	ChannelHealth
+	watchedAt    time.Time
+	lastChecked  time.Time
+	checkedCount uint64
+}
+
+// NewHealthMonitor creates a new HealthMonitor.
+func NewHealthMonitor(config HealthConfig) *HealthMonitor {
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = DEFAULT_HEALTH_CHECK_INTERVAL
+	}
+
+	return &HealthMonitor{
+		config:   config,
+		channels: make(map[string]*channelHealth),
+		done:     make(chan struct{}),
+	}
+}
+
+// OnStale registers a callback called when a channel becomes stale.
+func (m *HealthMonitor) OnStale(fn func(health ChannelHealth)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onStale = append(m.onStale, fn)
+}
+
+// OnFresh registers a callback called when a stale channel delivers again.
+func (m *HealthMonitor) OnFresh(fn func(health ChannelHealth)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onFresh = append(m.onFresh, fn)
+}
+
+// Watch starts tracking the channel before its first publication.
+func (m *HealthMonitor) Watch(channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.channel(channel, time.Now())
+}
+
+// Start starts checking for stale channels.
+func (m *HealthMonitor) Start() {
+	go m.run()
+}
+
+// Stop stops checking.
+func (m *HealthMonitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+// Observe records a publication.
+func (m *HealthMonitor) Observe(p Publication) {
+	received := p.Time
+	if received.IsZero() {
+		received = time.Now()
+	}
+
+	latency, hasLatency := payloadLatency(p.Data, received)
+
+	m.mu.Lock()
+	ch := m.channel(p.Channel, received)
+	ch.LastMessage = received
+	ch.Messages++
+	if hasLatency {
+		ch.Latency = latency
+	}
+	fresh := ch.Stale
+	ch.Stale = false
+	health := ch.ChannelHealth
+	handlers := append([]func(ChannelHealth){}, m.onFresh...)
+	m.mu.Unlock()
+
+	if fresh {
+		logrus.Infof("Channel %s is alive again", p.Channel)
+		for _, fn := range handlers {
+			fn(health)
+		}
+	}
+}
+
+// Health returns the metrics of the channel.
+func (m *HealthMonitor) Health(channel string) (ChannelHealth, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch, ok := m.channels[channel]
+	if !ok {
+		return ChannelHealth{}, false
+	}
+
+	return ch.ChannelHealth, true
+}
+
+// Stats returns the metrics of all tracked channels sorted by channel.
+func (m *HealthMonitor) Stats() []ChannelHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]ChannelHealth, 0, len(m.channels))
+	for _, ch := range m.channels {
+		res = append(res, ch.ChannelHealth)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Channel < res[j].Channel
+	})
+
+	return res
+}
+
+// run checks channels until stopped.
+func (m *HealthMonitor) run() {
+	ticker := time.NewTicker(m.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.check(now)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// check updates rates and reports channels which became stale.
+func (m *HealthMonitor) check(now time.Time) {
+	var stale []ChannelHealth
+
+	m.mu.Lock()
+	for channel, ch := range m.channels {
+		if elapsed := now.Sub(ch.lastChecked); elapsed > 0 {
+			ch.Rate = float64(ch.Messages-ch.checkedCount) / elapsed.Seconds()
+			ch.lastChecked = now
+			ch.checkedCount = ch.Messages
+		}
+
+		threshold, ok := m.staleAfter(channel)
+		if !ok || ch.Stale {
+			continue
+		}
+
+		last := ch.LastMessage
+		if last.IsZero() {
+			last = ch.watchedAt
+		}
+
+		if now.Sub(last) > threshold {
+			ch.Stale = true
+			stale = append(stale, ch.ChannelHealth)
+		}
+	}
+	handlers := append([]func(ChannelHealth){}, m.onStale...)
+	m.mu.Unlock()
+
+	for _, health := range stale {
+		logrus.Warnf("Channel %s is stale, last message at %s", health.Channel, health.LastMessage.Format(time.RFC3339))
+		for _, fn := range handlers {
+			fn(health)
+		}
+	}
+}
+
+// channel returns the tracked state of the channel, creating it if needed. Caller must hold mu.
+func (m *HealthMonitor) channel(channel string, now time.Time) *channelHealth {
+	ch, ok := m.channels[channel]
+	if !ok {
+		ch = &channelHealth{
+			ChannelHealth: ChannelHealth{Channel: channel},
+			watchedAt:     now,
+			lastChecked:   now,
+		}
+		m.channels[channel] = ch
+	}
+
+	return ch
+}
+
+// staleAfter returns the staleness threshold of the channel.
+func (m *HealthMonitor) staleAfter(channel string) (time.Duration, bool) {
+	for prefix, threshold := range m.config.StaleAfter {
+		if strings.HasPrefix(channel, prefix) && threshold > 0 {
+			return threshold, true
+		}
+	}
+
+	return 0, false
+}
+
+// payloadLatency returns the delay between the payload timestamp and the receive time.
+// Market data carries last_update_time, orderbook and trades carry timestamp.
+func payloadLatency(data []byte, received time.Time) (time.Duration, bool) {
+	var payload struct {
+		Timestamp      int64 `json:"timestamp"`
+		LastUpdateTime int64 `json:"last_update_time"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return 0, false
+	}
+
+	ts := payload.Timestamp
+	if ts == 0 {
+		ts = payload.LastUpdateTime
+	}
+	if ts <= 0 {
+		return 0, false
+	}
+
+	return received.Sub(unixTime(ts)), true
+}
+
+// unixTime converts a Unix timestamp in seconds, milliseconds, microseconds or nanoseconds,
+// told apart by magnitude, to time.
+func unixTime(ts int64) time.Time {
+	switch {
+	case ts < 1e11:
+		return time.Unix(ts, 0)
+	case ts < 1e14:
+		return time.UnixMilli(ts)
+	case ts < 1e17:
+		return time.UnixMicro(ts)
+	}
+
+	return time.Unix(0, ts)
+}
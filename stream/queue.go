@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy decides what a Queue does with a publication arriving while it is full.
+type OverflowPolicy int
+
+// Overflow policies.
+const (
+	// OVERFLOW_BLOCK waits for free space, which blocks the websocket event loop
+	// until the consumer catches up. Nothing is lost.
+	OVERFLOW_BLOCK OverflowPolicy = iota
+
+	// OVERFLOW_DROP_OLDEST discards the oldest queued publication.
+	OVERFLOW_DROP_OLDEST
+
+	// OVERFLOW_COALESCE_LATEST discards all queued publications and keeps only the new one.
+	// It suits channels where the latest message matters most, such as market data.
+	// Coalescing orderbook updates leaves a sequence gap, so the book resyncs.
+	OVERFLOW_COALESCE_LATEST
+)
+
+// DROP_LOG_INTERVAL is the number of dropped publications between two warnings.
+const DROP_LOG_INTERVAL = 1000
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OVERFLOW_BLOCK:
+		return "block"
+	case OVERFLOW_DROP_OLDEST:
+		return "drop-oldest"
+	case OVERFLOW_COALESCE_LATEST:
+		return "coalesce-latest"
+	}
+
+	return "unknown"
+}
+
+// Queue is a bounded FIFO of publications delivered to a handler by a single
+// goroutine, so the handler sees publications in the order they arrived and
+// may block without stalling the websocket event loop.
+type Queue struct {
+	channel  string
+	size     int
+	policy   OverflowPolicy
+	handler  Handler
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []Publication
+	closed   bool
+	dropped  atomic.Uint64
+	gap      bool
+	onGap    func()
+	onClose  func()
+}
+
+// NewQueue creates a queue of the given capacity and starts delivering to handler.
+// Non-positive size means DEFAULT_BUFFER_SIZE.
+func NewQueue(channel string, size int, policy OverflowPolicy, handler Handler) *Queue {
+	if size <= 0 {
+		size = DEFAULT_BUFFER_SIZE
+	}
+
+	q := &Queue{
+		channel: channel,
+		size:    size,
+		policy:  policy,
+		handler: handler,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+
+	go q.run()
+
+	return q
+}
+
+// Push adds a publication, applying the overflow policy if the queue is full.
+// Publications pushed after Close are discarded.
+func (q *Queue) Push(p Publication) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := 0
+	for !q.closed && len(q.items) >= q.size {
+		switch q.policy {
+		case OVERFLOW_DROP_OLDEST:
+			q.items[0] = Publication{}
+			q.items = q.items[1:]
+			dropped = 1
+		case OVERFLOW_COALESCE_LATEST:
+			dropped = len(q.items)
+			q.items = q.items[:0]
+		default:
+			q.notFull.Wait()
+		}
+	}
+
+	if q.closed {
+		return
+	}
+
+	q.items = append(q.items, p)
+	q.notEmpty.Signal()
+
+	if dropped > 0 {
+		q.gap = true
+		q.countDropped(uint64(dropped))
+	}
+}
+
+// OnGap registers a callback called by the delivery goroutine before the first
+// publication following dropped ones, e.g. to reconcile state built from the
+// channel over REST. The handler sees publications after the gap once it returns.
+func (q *Queue) OnGap(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.onGap = fn
+}
+
+// Dropped returns the number of publications discarded by the overflow policy.
+func (q *Queue) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+// Len returns the number of queued publications.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// Policy returns the overflow policy of the queue.
+func (q *Queue) Policy() OverflowPolicy {
+	return q.policy
+}
+
+// Close stops delivery and discards queued publications.
+// A queue created by SubscribeQueued also unsubscribes from its channel.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.items = nil
+	onClose := q.onClose
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+
+	if onClose != nil {
+		onClose()
+	}
+}
+
+// run delivers publications until the queue is closed.
+func (q *Queue) run() {
+	for {
+		q.mu.Lock()
+		for !q.closed && len(q.items) == 0 {
+			q.notEmpty.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+
+		p := q.items[0]
+		q.items[0] = Publication{}
+		q.items = q.items[1:]
+		gap := q.gap
+		q.gap = false
+		onGap := q.onGap
+		q.notFull.Signal()
+		q.mu.Unlock()
+
+		if gap && onGap != nil {
+			onGap()
+		}
+		q.handler(p)
+	}
+}
+
+// countDropped adds to the drop counter and warns periodically. Caller must hold mu.
+func (q *Queue) countDropped(n uint64) {
+	before := q.dropped.Add(n) - n
+	if before == 0 || before/DROP_LOG_INTERVAL != (before+n)/DROP_LOG_INTERVAL {
+		logrus.Warnf("Consumer of %s is too slow, %d publications dropped (%s)", q.channel, before+n, q.policy)
+	}
+}
+
+// SubscribeQueued delivers publications of the channel to handler through a Queue.
+// Closing the queue unsubscribes, the queue is also closed with the stream.
+func (s *Stream) SubscribeQueued(channel string, size int, policy OverflowPolicy, handler Handler) (*Queue, error) {
+	q := NewQueue(channel, size, policy, handler)
+
+	unsubscribe, err := s.subscribe(channel, q.Push, q.Close)
+	if err != nil {
+		q.Close()
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.onClose = unsubscribe
+	q.mu.Unlock()
+
+	return q, nil
+}
@@ -0,0 +1,199 @@
+package stream
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedConsumer records delivered publications and holds each delivery until released.
+type gatedConsumer struct {
+	mu       sync.Mutex
+	received []string
+	started  chan struct{}
+	gate     chan struct{}
+}
+
+// newGatedConsumer returns a consumer holding deliveries until release is called.
+func newGatedConsumer() *gatedConsumer {
+	return &gatedConsumer{
+		started: make(chan struct{}, 100),
+		gate:    make(chan struct{}),
+	}
+}
+
+// handle implements Handler.
+func (c *gatedConsumer) handle(p Publication) {
+	c.record(string(p.Data))
+	c.started <- struct{}{}
+	<-c.gate
+}
+
+// record appends an entry to the delivery log.
+func (c *gatedConsumer) record(entry string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.received = append(c.received, entry)
+}
+
+// release lets every delivery through.
+func (c *gatedConsumer) release() {
+	close(c.gate)
+}
+
+// waitStarted waits for the consumer to take a publication.
+func (c *gatedConsumer) waitStarted(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-c.started:
+	case <-time.After(time.Second):
+		t.Fatal("publication was not delivered")
+	}
+}
+
+// waitReceived waits until n entries were logged and returns them.
+func (c *gatedConsumer) waitReceived(t *testing.T, n int) []string {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		received := append([]string(nil), c.received...)
+		c.mu.Unlock()
+
+		if len(received) >= n || time.Now().After(deadline) {
+			return received
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// push pushes publications with the given data.
+func push(q *Queue, data ...string) {
+	for _, d := range data {
+		q.Push(Publication{Channel: "trade:BTC-USD", Data: []byte(d)})
+	}
+}
+
+func TestQueueOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  OverflowPolicy
+		pushed  []string
+		want    []string
+		dropped uint64
+	}{
+		{"drop oldest", OVERFLOW_DROP_OLDEST, []string{"2", "3", "4"}, []string{"1", "3", "4"}, 1},
+		{"coalesce latest", OVERFLOW_COALESCE_LATEST, []string{"2", "3", "4", "5"}, []string{"1", "4", "5"}, 2},
+		{"not full", OVERFLOW_COALESCE_LATEST, []string{"2", "3"}, []string{"1", "2", "3"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newGatedConsumer()
+			q := NewQueue("trade:BTC-USD", 2, tt.policy, c.handle)
+			defer q.Close()
+
+			// The first publication is held by the consumer, the others wait in the queue.
+			push(q, "1")
+			c.waitStarted(t)
+			push(q, tt.pushed...)
+
+			if q.Dropped() != tt.dropped {
+				t.Errorf("Dropped() = %d, want %d", q.Dropped(), tt.dropped)
+			}
+
+			c.release()
+			if got := c.waitReceived(t, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("received = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueOverflowBlock(t *testing.T) {
+	c := newGatedConsumer()
+	q := NewQueue("account@1", 1, OVERFLOW_BLOCK, c.handle)
+	defer q.Close()
+	q.OnGap(func() { c.record("gap") })
+
+	push(q, "1")
+	c.waitStarted(t)
+	push(q, "2")
+
+	pushed := make(chan struct{})
+	go func() {
+		push(q, "3")
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Push() returned while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.release()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push() is still blocked after the consumer caught up")
+	}
+
+	if got, want := c.waitReceived(t, 3), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received = %v, want %v", got, want)
+	}
+	if q.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", q.Dropped())
+	}
+}
+
+func TestQueueCloseReleasesBlockedPush(t *testing.T) {
+	c := newGatedConsumer()
+	defer c.release()
+	q := NewQueue("account@1", 1, OVERFLOW_BLOCK, c.handle)
+
+	push(q, "1")
+	c.waitStarted(t)
+	push(q, "2")
+
+	pushed := make(chan struct{})
+	go func() {
+		push(q, "3")
+		close(pushed)
+	}()
+
+	q.Close()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push() is still blocked after Close()")
+	}
+
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d after Close(), want 0", q.Len())
+	}
+}
+
+func TestQueueOnGap(t *testing.T) {
+	c := newGatedConsumer()
+	q := NewQueue("account@1", 1, OVERFLOW_DROP_OLDEST, c.handle)
+	defer q.Close()
+	q.OnGap(func() { c.record("gap") })
+
+	push(q, "1")
+	c.waitStarted(t)
+	push(q, "2", "3", "4")
+
+	c.release()
+	c.waitReceived(t, 3)
+	push(q, "5")
+
+	// The gap is reported once, before the first publication after the dropped ones.
+	if got, want := c.waitReceived(t, 4), []string{"1", "gap", "4", "5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received = %v, want %v", got, want)
+	}
+}
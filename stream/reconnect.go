@@ -0,0 +1,181 @@
+package stream
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/centrifugal/centrifuge-go"
+	"github.com/sirupsen/logrus"
+)
+
+// DISCONNECT_CALLED is the disconnect code used when the connection was closed by the client itself.
+const DISCONNECT_CALLED uint32 = 0
+
+// ReconnectPolicy decides when the stream connects again after the server closed
+// the connection for good, e.g. on an unauthorized or bad protocol disconnect.
+// Transport failures are retried by the websocket library itself
+// with a jittered backoff between 200ms and 20s, which is not configurable.
+type ReconnectPolicy struct {
+	MinDelay    time.Duration // The delay before the first attempt.
+	MaxDelay    time.Duration // The upper bound of the delay.
+	Factor      float64       // The multiplier of the delay after each failed attempt.
+	Jitter      bool          // Randomize delays to spread reconnects of many clients.
+	MaxAttempts int           // The number of attempts before giving up, unlimited if zero.
+}
+
+// DefaultReconnectPolicy is the policy of new streams.
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MinDelay: 500 * time.Millisecond,
+	MaxDelay: 30 * time.Second,
+	Factor:   2,
+	Jitter:   true,
+}
+
+// Delay returns the delay before the attempt, counted from zero.
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	factor := p.Factor
+	if factor < 1 {
+		factor = 1
+	}
+
+	delay := float64(p.MinDelay) * math.Pow(factor, float64(attempt))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if p.Jitter {
+		delay = delay/2 + rand.Float64()*delay/2
+	}
+
+	return time.Duration(delay)
+}
+
+// SetReconnectPolicy sets the policy applied after the server closes the connection.
+func (s *Stream) SetReconnectPolicy(policy ReconnectPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policy = policy
+}
+
+// OnRecovery registers a callback called when a subscription is established again after reconnect.
+// recovered is false when the server could not replay the publications sent while
+// disconnected, so the state built from the channel must be reconciled. It is also
+// called with recovered false when a typed subscription drops publications.
+func (s *Stream) OnRecovery(fn func(channel string, recovered bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onRecovery = append(s.onRecovery, fn)
+}
+
+// Connected reports whether the stream is connected.
+func (s *Stream) Connected() bool {
+	return s.ws.State() == centrifuge.StateConnected
+}
+
+// handleConnected resets reconnect attempts and calls the connected callbacks.
+func (s *Stream) handleConnected() {
+	s.mu.Lock()
+	s.connected = true
+	s.attempts = 0
+	handlers := append([]func(){}, s.onConnected...)
+	s.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn()
+	}
+}
+
+// handleConnectionLost calls the disconnected callbacks once per lost connection.
+// Permanent disconnects are retried according to the reconnect policy.
+func (s *Stream) handleConnectionLost(code uint32, reason string, permanent bool) {
+	s.mu.Lock()
+	wasConnected := s.connected
+	s.connected = false
+	handlers := append([]func(uint32, string){}, s.onDisconnected...)
+	s.mu.Unlock()
+
+	if wasConnected {
+		for _, fn := range handlers {
+			fn(code, reason)
+		}
+	}
+
+	if permanent && code != DISCONNECT_CALLED {
+		s.scheduleReconnect()
+	}
+}
+
+// scheduleReconnect connects again after the policy delay unless the stream is closed.
+func (s *Stream) scheduleReconnect() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+
+	policy := s.policy
+	attempt := s.attempts
+	if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+		s.mu.Unlock()
+		logrus.Errorf("Giving up reconnecting to %s after %d attempts", s.wsUrl, attempt)
+		return
+	}
+	s.attempts++
+	s.mu.Unlock()
+
+	delay := policy.Delay(attempt)
+	logrus.Infof("Reconnecting to %s in %s (attempt %d)", s.wsUrl, delay, attempt+1)
+
+	time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+
+		if closed {
+			return
+		}
+
+		if err := s.ws.Connect(); err != nil {
+			logrus.Errorf("Failed to reconnect: %s", err)
+		}
+	})
+}
+
+// reportGap calls the recovery callbacks for publications of the channel lost without reconnect.
+func (s *Stream) reportGap(channel string) {
+	s.mu.Lock()
+	handlers := append([]func(string, bool){}, s.onRecovery...)
+	s.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(channel, false)
+	}
+}
+
+// handleSubscribed detects subscriptions established again without recovering missed publications.
+func (s *Stream) handleSubscribed(channel string, sub *subscription, e centrifuge.SubscribedEvent) {
+	s.mu.Lock()
+	resubscribed := sub.subscribed
+	sub.subscribed = true
+	handlers := append([]func(string, bool){}, s.onRecovery...)
+	s.mu.Unlock()
+
+	if !resubscribed {
+		logrus.Info("Subscribed successfully to channel: ", channel)
+		return
+	}
+
+	recovered := e.WasRecovering && e.Recovered
+	if recovered {
+		logrus.Infof("Resubscribed to channel %s, missed publications recovered", channel)
+	} else {
+		logrus.Warnf("Resubscribed to channel %s, missed publications were not recovered", channel)
+	}
+
+	for _, fn := range handlers {
+		fn(channel, recovered)
+	}
+}
@@ -0,0 +1,397 @@
+package stream
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Default recorder settings.
+const (
+	// DEFAULT_RECORD_MAX_BYTES is the uncompressed size after which a recording file is rotated.
+	DEFAULT_RECORD_MAX_BYTES = 256 << 20
+
+	// DEFAULT_RECORD_MAX_AGE is the time after which a recording file is rotated.
+	DEFAULT_RECORD_MAX_AGE = time.Hour
+
+	// DEFAULT_RECORD_FLUSH_INTERVAL is the time between two flushes of the current file.
+	DEFAULT_RECORD_FLUSH_INTERVAL = time.Second
+
+	// SNAPSHOT_PREFIX is the prefix of recorded REST snapshots, followed by the channel
+	// whose state they hold, e.g. snapshot:orderbook:BTC-USD.
+	SNAPSHOT_PREFIX = "snapshot:"
+
+	// RECORD_FILE_EXT is the extension of recording files.
+	RECORD_FILE_EXT = ".jsonl.gz"
+)
+
+// Record is one line of a recording.
+type Record struct {
+	Channel string          `json:"channel"` // The websocket channel.
+	Time    int64           `json:"time"`    // The receive time in Unix nanoseconds.
+	Offset  uint64          `json:"offset"`  // The offset of the publication in the channel history.
+	Data    json.RawMessage `json:"data"`    // The raw JSON data.
+}
+
+// RecorderConfig configures a Recorder.
+type RecorderConfig struct {
+	Dir           string        // The directory of recording files.
+	Prefix        string        // The prefix of file names, "stream" if empty.
+	MaxBytes      int64         // The uncompressed size of a file before rotation, DEFAULT_RECORD_MAX_BYTES if zero.
+	MaxAge        time.Duration // The age of a file before rotation, DEFAULT_RECORD_MAX_AGE if zero.
+	FlushInterval time.Duration // The time between flushes, DEFAULT_RECORD_FLUSH_INTERVAL if zero.
+}
+
+// Recorder writes publications to gzip compressed JSONL files, one Record per line.
+// A new file is started when the current one grows over MaxBytes or gets older than MaxAge.
+// The current file is flushed every FlushInterval, so a crash loses at most that much.
+// Attach it to a stream with Stream.Tap(recorder.Record).
+type Recorder struct {
+	config  RecorderConfig
+	mu      sync.Mutex
+	file    *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	written int64
+	opened  time.Time
+	closed  bool
+	dirty   bool
+	done    chan struct{}
+}
+
+// NewRecorder creates a new Recorder, the directory is created if missing.
+func NewRecorder(config RecorderConfig) (*Recorder, error) {
+	if config.Prefix == "" {
+		config.Prefix = "stream"
+	}
+
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DEFAULT_RECORD_MAX_BYTES
+	}
+
+	if config.MaxAge <= 0 {
+		config.MaxAge = DEFAULT_RECORD_MAX_AGE
+	}
+
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DEFAULT_RECORD_FLUSH_INTERVAL
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{config: config, done: make(chan struct{})}
+	go r.run()
+
+	return r, nil
+}
+
+// Record writes the publication. Errors are logged, recording must not disturb the stream.
+func (r *Recorder) Record(p Publication) {
+	if err := r.write(p); err != nil {
+		logrus.Errorf("Failed to record publication of %s: %s", p.Channel, err)
+	}
+}
+
+// RecordSnapshot writes a snapshot of the channel state loaded over REST,
+// e.g. an orderbook, so a replay can sync from it. Errors are logged.
+func (r *Recorder) RecordSnapshot(channel string, snapshot interface{}) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		logrus.Errorf("Failed to record snapshot of %s: %s", channel, err)
+		return
+	}
+
+	r.Record(Publication{
+		Channel: SNAPSHOT_PREFIX + channel,
+		Data:    data,
+		Time:    time.Now(),
+	})
+}
+
+// Flush writes buffered publications through to the current file.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil || !r.dirty {
+		return nil
+	}
+	r.dirty = false
+
+	return errors.Join(r.buf.Flush(), r.gz.Flush())
+}
+
+// Close flushes and closes the current file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		close(r.done)
+	}
+
+	return r.closeFile()
+}
+
+// run flushes periodically until closed.
+func (r *Recorder) run() {
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(); err != nil {
+				logrus.Errorf("Failed to flush recording: %s", err)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// write appends the publication, rotating the file if needed.
+func (r *Recorder) write(p Publication) error {
+	line, err := json.Marshal(Record{
+		Channel: p.Channel,
+		Time:    p.Time.UnixNano(),
+		Offset:  p.Offset,
+		Data:    json.RawMessage(p.Data),
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	if r.file != nil && (r.written >= r.config.MaxBytes || time.Since(r.opened) >= r.config.MaxAge) {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+
+	if r.file == nil {
+		if err := r.openFile(); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.buf.Write(append(line, '\n'))
+	r.written += int64(n)
+	r.dirty = true
+
+	return err
+}
+
+// openFile starts a new recording file. Caller must hold mu.
+func (r *Recorder) openFile() error {
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%s%s", r.config.Prefix, now.Format("20060102-150405.000000000"), RECORD_FILE_EXT)
+
+	file, err := os.OpenFile(filepath.Join(r.config.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.buf = bufio.NewWriter(r.gz)
+	r.written = 0
+	r.opened = now
+
+	logrus.Infof("Recording publications to %s", file.Name())
+
+	return nil
+}
+
+// closeFile flushes and closes the current file. Caller must hold mu.
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := errors.Join(r.buf.Flush(), r.gz.Close(), r.file.Close())
+	r.file, r.gz, r.buf = nil, nil, nil
+
+	return err
+}
+
+// ReplayOptions configures Replayer.Run.
+type ReplayOptions struct {
+	Speed float64         // The playback speed, 1 is the original speed, 0 or less delivers without delay.
+	Step  <-chan struct{} // If set, each receive delivers one publication and Speed is ignored.
+}
+
+// Replayer reads recordings written by a Recorder.
+// Publications are delivered in the order they were recorded.
+type Replayer struct {
+	paths []string
+	file  *os.File
+	gz    *gzip.Reader
+	dec   *json.Decoder
+}
+
+// NewReplayer creates a replayer of the files in the order given.
+// A directory stands for all its recording files sorted by name, which is also their time order.
+func NewReplayer(paths ...string) (*Replayer, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*"+RECORD_FILE_EXT))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no recording files to replay")
+	}
+
+	return &Replayer{paths: files}, nil
+}
+
+// Next returns the next recorded publication or io.EOF after the last one.
+func (r *Replayer) Next() (Publication, error) {
+	for {
+		if r.dec == nil {
+			if len(r.paths) == 0 {
+				return Publication{}, io.EOF
+			}
+			path := r.paths[0]
+			r.paths = r.paths[1:]
+
+			err := r.open(path)
+			if errors.Is(err, io.EOF) {
+				// Nothing was flushed before the recorder stopped.
+				logrus.Warnf("Recording %s is empty", path)
+				continue
+			}
+			if err != nil {
+				return Publication{}, err
+			}
+		}
+
+		var record Record
+		err := r.dec.Decode(&record)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// The recorder was not closed, e.g. the process was killed.
+			logrus.Warnf("Recording %s is truncated", r.file.Name())
+			err = io.EOF
+		}
+		if errors.Is(err, io.EOF) {
+			if err := r.Close(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return Publication{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return Publication{}, err
+		}
+
+		return Publication{
+			Channel: record.Channel,
+			Data:    record.Data,
+			Offset:  record.Offset,
+			Time:    time.Unix(0, record.Time),
+		}, nil
+	}
+}
+
+// Run delivers all publications to handler paced as configured by the options.
+// It returns nil when the recording is exhausted or the step channel is closed.
+func (r *Replayer) Run(options ReplayOptions, handler Handler) error {
+	defer r.Close()
+
+	var first time.Time
+	start := time.Now()
+
+	for {
+		if options.Step != nil {
+			if _, ok := <-options.Step; !ok {
+				return nil
+			}
+		}
+
+		p, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if options.Step == nil && options.Speed > 0 {
+			if first.IsZero() {
+				first = p.Time
+			}
+
+			due := start.Add(time.Duration(float64(p.Time.Sub(first)) / options.Speed))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		handler(p)
+	}
+}
+
+// Close closes the current file.
+func (r *Replayer) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := errors.Join(r.gz.Close(), r.file.Close())
+	r.file, r.gz, r.dec = nil, nil, nil
+
+	return err
+}
+
+// open starts reading a recording file.
+func (r *Replayer) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	r.file = file
+	r.gz = gz
+	r.dec = json.NewDecoder(gz)
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorderFlushWithoutClose(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(RecorderConfig{Dir: dir, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Record(Publication{Channel: "orderbook:BTC-USD", Data: []byte(`{"sequence":2}`), Time: time.Now()})
+	r.RecordSnapshot("orderbook:BTC-USD", map[string]int{"sequence": 1})
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is read as left by a crash, the gzip stream is not terminated.
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayer.Close()
+
+	var channels []string
+	if err := replayer.Run(ReplayOptions{}, func(p Publication) {
+		channels = append(channels, p.Channel)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(channels) != 2 || channels[0] != "orderbook:BTC-USD" || channels[1] != SNAPSHOT_PREFIX+"orderbook:BTC-USD" {
+		t.Errorf("replayed channels = %v, want the publication and the snapshot", channels)
+	}
+}
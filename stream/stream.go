@@ -0,0 +1,415 @@
+// Package stream provides typed subscriptions to RabbitX websocket channels.
+// It manages the websocket connection independently of the bot, so any tool
+// can consume market, orderbook, trade and account data.
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"rabbitx-client/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Channel prefixes, the channel name is the prefix followed by market or profile ID.
+const (
+	// MARKET_PREFIX is the prefix of market data channels.
+	MARKET_PREFIX = "market:"
+
+	// ORDERBOOK_PREFIX is the prefix of orderbook channels.
+	ORDERBOOK_PREFIX = "orderbook:"
+
+	// TRADE_PREFIX is the prefix of trade channels.
+	TRADE_PREFIX = "trade:"
+
+	// ACCOUNT_PREFIX is the prefix of private account channels.
+	ACCOUNT_PREFIX = model.ACCOUNT_PREFIX
+)
+
+// DEFAULT_BUFFER_SIZE is the capacity of typed subscription channels.
+const DEFAULT_BUFFER_SIZE = 1024
+
+// ErrClosed is returned when subscribing on a closed stream.
+var ErrClosed = errors.New("stream is closed")
+
+// Publication is a raw message received from a channel.
+type Publication struct {
+	Channel string    // The websocket channel.
+	Data    []byte    // The raw JSON data.
+	Offset  uint64    // The offset of the publication in the channel history.
+	Time    time.Time // The time the publication was received.
+}
+
+// Handler receives publications of a channel. It must not block,
+// the websocket event loop waits for it.
+type Handler func(Publication)
+
+// Stream is a websocket connection to RabbitX with any number of subscriptions.
+// Several consumers may subscribe to the same channel, the websocket
+// subscription is shared and removed when the last consumer unsubscribes.
+type Stream struct {
+	wsUrl          string
+	ws             *centrifuge.Client
+	mu             sync.Mutex
+	subs           map[string]*subscription
+	taps           map[int]Handler
+	nextTapId      int
+	closed         bool
+	onConnected    []func()
+	onDisconnected []func(code uint32, reason string)
+	onRecovery     []func(channel string, recovered bool)
+	policy         ReconnectPolicy
+	connected      bool
+	attempts       int
+}
+
+// subscription is a websocket subscription shared by handlers.
+type subscription struct {
+	sub        *centrifuge.Subscription
+	nextId     int
+	handlers   map[int]Handler
+	closers    map[int]func() // The closers of typed channels and queues, by handler ID.
+	subscribed bool
+}
+
+// New creates a new Stream. token is a JWT, it is required for account channels.
+func New(wsUrl, token string) *Stream {
+	s := &Stream{
+		wsUrl:  wsUrl,
+		subs:   make(map[string]*subscription),
+		taps:   make(map[int]Handler),
+		policy: DefaultReconnectPolicy,
+	}
+
+	s.ws = centrifuge.NewJsonClient(
+		wsUrl,
+		centrifuge.Config{
+			Token:            token,
+			ReadTimeout:      10 * time.Second,
+			WriteTimeout:     10 * time.Second,
+			HandshakeTimeout: 10 * time.Second,
+		},
+	)
+
+	s.ws.OnConnecting(func(e centrifuge.ConnectingEvent) {
+		logrus.Infof("Connecting - %d (%s) url: %s", e.Code, e.Reason, s.wsUrl)
+
+		// The library reconnects by itself after transport failures.
+		s.handleConnectionLost(e.Code, e.Reason, false)
+	})
+
+	s.ws.OnConnected(func(e centrifuge.ConnectedEvent) {
+		logrus.Infof("Connected with ID %s", e.ClientID)
+
+		s.handleConnected()
+	})
+
+	s.ws.OnDisconnected(func(e centrifuge.DisconnectedEvent) {
+		logrus.Infof("Disconnected: %d (%s)", e.Code, e.Reason)
+
+		s.handleConnectionLost(e.Code, e.Reason, true)
+	})
+
+	s.ws.OnError(func(e centrifuge.ErrorEvent) {
+		logrus.Errorf("Websocket server connection Error: %s", e.Error.Error())
+	})
+
+	return s
+}
+
+// OnConnected registers a callback called every time the connection is established.
+func (s *Stream) OnConnected(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onConnected = append(s.onConnected, fn)
+}
+
+// OnDisconnected registers a callback called every time the connection is lost,
+// whether the library reconnects by itself or the server closed the connection.
+func (s *Stream) OnDisconnected(fn func(code uint32, reason string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onDisconnected = append(s.onDisconnected, fn)
+}
+
+// Connect connects to the websocket server. Subscriptions made before
+// connecting are activated once connected.
+func (s *Stream) Connect() error {
+	return s.ws.Connect()
+}
+
+// Close closes the connection and all typed subscription channels.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	var closers []func()
+	for _, sub := range s.subs {
+		for _, fn := range sub.closers {
+			closers = append(closers, fn)
+		}
+	}
+	s.subs = make(map[string]*subscription)
+	s.mu.Unlock()
+
+	// Release queues blocked on a slow consumer before waiting for the event loop.
+	for _, fn := range closers {
+		fn()
+	}
+
+	s.ws.Close()
+}
+
+// Subscribe calls handler for every publication in the channel.
+// It returns a function removing the handler.
+func (s *Stream) Subscribe(channel string, handler Handler) (func(), error) {
+	return s.subscribe(channel, handler, nil)
+}
+
+// subscribe adds the handler to the channel. The optional closer is called
+// when the stream is closed and forgotten when the handler is removed.
+func (s *Stream) subscribe(channel string, handler Handler, closer func()) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	sub, ok := s.subs[channel]
+	if !ok {
+		var err error
+		sub, err = s.newSubscription(channel)
+		if err != nil {
+			return nil, err
+		}
+		s.subs[channel] = sub
+	}
+
+	id := sub.nextId
+	sub.nextId++
+	sub.handlers[id] = handler
+	if closer != nil {
+		sub.closers[id] = closer
+	}
+
+	return func() {
+		s.unsubscribe(channel, id)
+	}, nil
+}
+
+// Tap calls handler for every publication of every channel before channel handlers,
+// e.g. to record the traffic. It returns a function removing the handler.
+func (s *Stream) Tap(handler Handler) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextTapId
+	s.nextTapId++
+	s.taps[id] = handler
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.taps, id)
+	}
+}
+
+// Raw returns a channel of raw publications of the websocket channel
+// and a function unsubscribing and closing the channel.
+func (s *Stream) Raw(channel string) (<-chan Publication, func(), error) {
+	return subscribeTyped(s, channel, func(p Publication) (Publication, error) {
+		return p, nil
+	})
+}
+
+// Market returns a channel of market data updates and a function unsubscribing and closing it.
+func (s *Stream) Market(marketId string) (<-chan model.MarketData, func(), error) {
+	return subscribeTyped(s, MARKET_PREFIX+marketId, decodeJson[model.MarketData])
+}
+
+// Orderbook returns a channel of orderbook updates and a function unsubscribing and closing it.
+func (s *Stream) Orderbook(marketId string) (<-chan model.OrderbookData, func(), error) {
+	return subscribeTyped(s, ORDERBOOK_PREFIX+marketId, decodeJson[model.OrderbookData])
+}
+
+// Trades returns a channel of public trades and a function unsubscribing and closing it.
+func (s *Stream) Trades(marketId string) (<-chan model.TradeData, func(), error) {
+	return subscribeTyped(s, TRADE_PREFIX+marketId, decodeJson[model.TradeData])
+}
+
+// Account returns a channel of private profile updates and a function unsubscribing and closing it.
+// The stream token must belong to the profile.
+func (s *Stream) Account(profileId uint) (<-chan model.ProfileData, func(), error) {
+	return subscribeTyped(s, AccountChannel(profileId), decodeJson[model.ProfileData])
+}
+
+// AccountChannel returns the account channel name of the profile.
+func AccountChannel(profileId uint) string {
+	return ACCOUNT_PREFIX + strconv.FormatUint(uint64(profileId), 10)
+}
+
+// newSubscription creates and starts a websocket subscription. Caller must hold mu.
+func (s *Stream) newSubscription(channel string) (*subscription, error) {
+	wsSub, err := s.ws.NewSubscription(channel, centrifuge.SubscriptionConfig{
+		Recoverable: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subscription{
+		sub:      wsSub,
+		handlers: make(map[int]Handler),
+		closers:  make(map[int]func()),
+	}
+
+	wsSub.OnSubscribed(func(e centrifuge.SubscribedEvent) {
+		s.handleSubscribed(channel, sub, e)
+	})
+
+	wsSub.OnPublication(func(e centrifuge.PublicationEvent) {
+		pub := Publication{
+			Channel: channel,
+			Data:    e.Data,
+			Offset:  e.Offset,
+			Time:    time.Now(),
+		}
+
+		s.mu.Lock()
+		handlers := make([]Handler, 0, len(s.taps)+len(sub.handlers))
+		for _, h := range s.taps {
+			handlers = append(handlers, h)
+		}
+		for _, h := range sub.handlers {
+			handlers = append(handlers, h)
+		}
+		s.mu.Unlock()
+
+		for _, h := range handlers {
+			h(pub)
+		}
+	})
+
+	logrus.Infof("Subscribing to channel: %s", channel)
+	if err := wsSub.Subscribe(); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// unsubscribe removes a handler and the websocket subscription if it was the last one.
+func (s *Stream) unsubscribe(channel string, id int) {
+	s.mu.Lock()
+	sub, ok := s.subs[channel]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+
+	delete(sub.handlers, id)
+	delete(sub.closers, id)
+	if len(sub.handlers) > 0 {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.subs, channel)
+	s.mu.Unlock()
+
+	if err := sub.sub.Unsubscribe(); err != nil {
+		logrus.Warnf("Failed to unsubscribe from %s: %s", channel, err)
+	}
+	if err := s.ws.RemoveSubscription(sub.sub); err != nil {
+		logrus.Warnf("Failed to remove subscription %s: %s", channel, err)
+	}
+}
+
+// subscribeTyped subscribes to the channel and delivers decoded publications
+// to a buffered channel, which is closed by the returned unsubscribe function
+// or when the stream is closed. Publications which fail to decode are logged
+// and skipped. Publications arriving while the buffer is full are dropped,
+// which the websocket event loop can not wait for, and the gap is reported
+// to OnRecovery callbacks with recovered false, so state built from the
+// channel is reconciled. Orderbook consumers also see it as a sequence gap.
+func subscribeTyped[T any](s *Stream, channel string, decode func(Publication) (T, error)) (<-chan T, func(), error) {
+	out := &sink[T]{ch: make(chan T, DEFAULT_BUFFER_SIZE)}
+
+	unsubscribe, err := s.subscribe(channel, func(p Publication) {
+		v, err := decode(p)
+		if err != nil {
+			logrus.Errorf("Failed to decode publication in %s: %s", channel, err)
+			return
+		}
+
+		if ok, gap := out.send(v); !ok && gap {
+			logrus.Warnf("Subscriber of %s is too slow, publications dropped", channel)
+			s.reportGap(channel)
+		}
+	}, out.close)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out.ch, func() {
+		unsubscribe()
+		out.close()
+	}, nil
+}
+
+// decodeJson decodes publication data as JSON.
+func decodeJson[T any](p Publication) (T, error) {
+	var v T
+	err := json.Unmarshal(p.Data, &v)
+	return v, err
+}
+
+// sink is a typed subscription channel safe to close while publications arrive.
+type sink[T any] struct {
+	mu       sync.Mutex
+	ch       chan T
+	closed   bool
+	dropping bool
+}
+
+// send delivers v without blocking, it returns false if the buffer is full.
+// gap is true for the first publication dropped after a delivered one.
+func (s *sink[T]) send(v T) (ok, gap bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return true, false
+	}
+
+	select {
+	case s.ch <- v:
+		s.dropping = false
+		return true, false
+	default:
+		gap = !s.dropping
+		s.dropping = true
+		return false, gap
+	}
+}
+
+// close closes the channel.
+func (s *sink[T]) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
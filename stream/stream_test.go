@@ -0,0 +1,55 @@
+package stream
+
+import "testing"
+
+// closerCount returns the number of closers held by the stream.
+func closerCount(s *Stream) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, sub := range s.subs {
+		n += len(sub.closers)
+	}
+
+	return n
+}
+
+func TestUnsubscribeDropsClosers(t *testing.T) {
+	s := New("ws://127.0.0.1:1/connection/websocket", "")
+	defer s.Close()
+
+	for i := 0; i < 100; i++ {
+		_, unsubscribe, err := s.Trades("BTC-USD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		unsubscribe()
+
+		q, err := s.SubscribeQueued(ORDERBOOK_PREFIX+"BTC-USD", 1, OVERFLOW_DROP_OLDEST, func(Publication) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Close()
+	}
+
+	if n := closerCount(s); n != 0 {
+		t.Errorf("closers after unsubscribing = %d, want 0", n)
+	}
+
+	trades, _, err := s.Trades("BTC-USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Trades("ETH-USD"); err != nil {
+		t.Fatal(err)
+	}
+	if n := closerCount(s); n != 2 {
+		t.Errorf("closers = %d, want 2", n)
+	}
+
+	s.Close()
+	if _, ok := <-trades; ok {
+		t.Error("trades channel is open after closing the stream")
+	}
+}